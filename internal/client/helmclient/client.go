@@ -96,10 +96,15 @@ func newClient(options *Options, clientGetter genericclioptions.RESTClientGetter
 		options.Output = os.Stdout
 	}
 
+	namespace := settings.Namespace()
+	if options.AllNamespaces {
+		namespace = ""
+	}
+
 	actionConfig := new(action.Configuration)
 	err = actionConfig.Init(
 		clientGetter,
-		settings.Namespace(),
+		namespace,
 		os.Getenv("HELM_DRIVER"),
 		debugLog,
 	)
@@ -273,6 +278,16 @@ func (c *HelmClient) RollbackRelease(spec *ChartSpec) error {
 	return c.rollbackRelease(spec)
 }
 
+// RollbackReleaseToRevision rolls back a release to the supplied revision.
+func (c *HelmClient) RollbackReleaseToRevision(spec *ChartSpec, revision int) error {
+	client := action.NewRollback(c.ActionConfig)
+
+	mergeRollbackOptions(spec, client)
+	client.Version = revision
+
+	return client.Run(spec.ReleaseName)
+}
+
 // UninstallRelease uninstalls the provided release
 func (c *HelmClient) UninstallRelease(spec *ChartSpec) error {
 	return c.uninstallRelease(spec)
@@ -1047,6 +1062,7 @@ func mergeInstallOptions(chartSpec *ChartSpec, installOptions *action.Install) {
 	installOptions.DryRun = chartSpec.DryRun
 	installOptions.SubNotes = chartSpec.SubNotes
 	installOptions.WaitForJobs = chartSpec.WaitForJobs
+	installOptions.Labels = chartSpec.Labels
 }
 
 // mergeUpgradeOptions merges values of the provided chart to helm upgrade options used by the client.
@@ -1067,6 +1083,7 @@ func mergeUpgradeOptions(chartSpec *ChartSpec, upgradeOptions *action.Upgrade) {
 	upgradeOptions.DryRun = chartSpec.DryRun
 	upgradeOptions.SubNotes = chartSpec.SubNotes
 	upgradeOptions.WaitForJobs = chartSpec.WaitForJobs
+	upgradeOptions.Labels = chartSpec.Labels
 }
 
 // mergeUninstallReleaseOptions merges values of the provided chart to helm uninstall options used by the client.
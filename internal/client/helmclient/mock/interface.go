@@ -53,20 +53,20 @@ func (mr *MockClientMockRecorder) AddOrUpdateChartRepo(entry interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrUpdateChartRepo", reflect.TypeOf((*MockClient)(nil).AddOrUpdateChartRepo), entry)
 }
 
-// GetChart mocks base method.
-func (m *MockClient) GetChart(chartName string, chartPathOptions *action.ChartPathOptions) (*chart.Chart, string, error) {
+// GetChartV2 mocks base method.
+func (m *MockClient) GetChartV2(spec *helmclient.ChartInfo) (*chart.Chart, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetChart", chartName, chartPathOptions)
+	ret := m.ctrl.Call(m, "GetChartV2", spec)
 	ret0, _ := ret[0].(*chart.Chart)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
-// GetChart indicates an expected call of GetChart.
-func (mr *MockClientMockRecorder) GetChart(chartName, chartPathOptions interface{}) *gomock.Call {
+// GetChartV2 indicates an expected call of GetChartV2.
+func (mr *MockClientMockRecorder) GetChartV2(spec interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChart", reflect.TypeOf((*MockClient)(nil).GetChart), chartName, chartPathOptions)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChartV2", reflect.TypeOf((*MockClient)(nil).GetChartV2), spec)
 }
 
 // GetRelease mocks base method.
@@ -202,6 +202,20 @@ func (mr *MockClientMockRecorder) RollbackRelease(spec interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollbackRelease", reflect.TypeOf((*MockClient)(nil).RollbackRelease), spec)
 }
 
+// RollbackReleaseToRevision mocks base method.
+func (m *MockClient) RollbackReleaseToRevision(spec *helmclient.ChartSpec, revision int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollbackReleaseToRevision", spec, revision)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollbackReleaseToRevision indicates an expected call of RollbackReleaseToRevision.
+func (mr *MockClientMockRecorder) RollbackReleaseToRevision(spec, revision interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollbackReleaseToRevision", reflect.TypeOf((*MockClient)(nil).RollbackReleaseToRevision), spec, revision)
+}
+
 // SetDebugLog mocks base method.
 func (m *MockClient) SetDebugLog(debugLog action.DebugLog) {
 	m.ctrl.T.Helper()
@@ -49,6 +49,9 @@ type Options struct {
 	RegistryConfig   string
 	Output           io.Writer
 	RegistryAuth     *RegistryAuth
+	// AllNamespaces makes the client operate on the releases of all
+	// namespaces instead of Namespace only. Used to list releases.
+	AllNamespaces bool
 }
 
 // RESTClientOption is a function that can be used to set the RESTClientOptions of a HelmClient.
@@ -195,6 +198,9 @@ type ChartSpec struct {
 	// KeepHistory indicates whether to retain or purge the release history during uninstall
 	// +optional
 	KeepHistory bool `json:"keepHistory,omitempty"`
+	// Labels are custom labels set on the release on install and upgrade.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
 
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
@@ -12,9 +13,13 @@ import (
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
 
 	"github.com/rs/zerolog"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage/driver"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/discovery"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 
@@ -29,23 +34,21 @@ var (
 	errCreateIncomplete = "cannot determine creation result - remove the " + meta.AnnotationKeyExternalCreatePending + " annotation if it is safe to proceed"
 )
 
-var _ controller.ExternalClient = (*handler)(nil)
+var (
+	_ controller.ExternalClient = (*handler)(nil)
+	_ controller.OrphanLister   = (*handler)(nil)
+)
 
-func NewHandler(cfg *rest.Config, log *zerolog.Logger, pig archive.Getter) controller.ExternalClient {
+func NewHandler(cfg *rest.Config, mapper apimeta.RESTMapper, log *zerolog.Logger, pig archive.Getter) controller.ExternalClient {
 	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Creating dynamic client.")
 	}
 
-	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating discovery client.")
-	}
-
 	return &handler{
 		logger:            log,
 		dynamicClient:     dyn,
-		discoveryClient:   dis,
+		mapper:            mapper,
 		packageInfoGetter: pig,
 	}
 }
@@ -53,11 +56,11 @@ func NewHandler(cfg *rest.Config, log *zerolog.Logger, pig archive.Getter) contr
 type handler struct {
 	logger            *zerolog.Logger
 	dynamicClient     dynamic.Interface
-	discoveryClient   *discovery.DiscoveryClient
+	mapper            apimeta.RESTMapper
 	packageInfoGetter archive.Getter
 }
 
-func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
+func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (obs controller.ExternalObservation, err error) {
 	log := h.logger.With().
 		Str("op", "Observe").
 		Str("apiVersion", mg.GetAPIVersion()).
@@ -65,31 +68,61 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		Str("name", mg.GetName()).
 		Str("namespace", mg.GetNamespace()).Logger()
 
+	upToDate := controller.ExternalObservation{
+		ResourceExists:   true,
+		ResourceUpToDate: true,
+	}
+
 	if h.packageInfoGetter == nil {
-		return false, fmt.Errorf("helm chart package info getter must be specified")
+		return controller.ExternalObservation{}, fmt.Errorf("helm chart package info getter must be specified")
 	}
 
 	pkg, err := h.packageInfoGetter.Get(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting package info")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
+	defer func() {
+		obs.PollInterval = pkg.PollInterval
+	}()
 
 	hc, err := h.helmClientForResource(mg, pkg.RegistryAuth)
 	if err != nil {
 		log.Err(err).Msg("Getting helm client")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
 
 	rel, err := helmchart.FindRelease(hc, mg.GetName())
 	if err != nil {
 		if !errors.Is(err, errReleaseNotFound) {
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 	}
 	if rel == nil {
 		log.Debug().Msg("Composition package not installed.")
-		return false, nil
+		return controller.ExternalObservation{}, nil
+	}
+
+	upToDate.ConnectionDetails, err = helmchart.ConnectionDetails(rel, pkg.ConnectionDetails)
+	if err != nil {
+		log.Err(err).Msg("Extracting connection details")
+		return controller.ExternalObservation{}, err
+	}
+
+	// A chart version bump on the definition rolls out to every composition.
+	diff, err := helmchart.CompareRelease(rel, mg, pkg.Version)
+	if err != nil {
+		log.Err(err).Msg("Comparing release values")
+		return controller.ExternalObservation{}, err
+	}
+	if diff != "" {
+		log.Debug().Str("diff", diff).Msg("Composition release not up-to-date.")
+		return controller.ExternalObservation{
+			ResourceExists:    true,
+			ResourceUpToDate:  false,
+			ConnectionDetails: upToDate.ConnectionDetails,
+			Diff:              diff,
+		}, nil
 	}
 
 	renderOpts := helmchart.RenderTemplateOptions{
@@ -106,66 +139,137 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		}
 	}
 
-	all, err := helmchart.RenderTemplate(ctx, renderOpts)
+	all, err := helmchart.RenderManifests(ctx, renderOpts)
 	if err != nil {
 		log.Err(err).Msg("Rendering helm chart template")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
+
+	_ = unstructured.SetNestedField(mg.Object, helmchart.ReleaseStatus(rel), "status", "helmRelease")
+	_ = unstructured.SetNestedSlice(mg.Object, helmchart.ManagedRefs(all), "status", "managed")
+
 	if len(all) == 0 {
-		return true, nil
+		return upToDate, tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
+		})
 	}
 
 	log.Debug().Str("package", pkg.URL).Msg("Checking composition resources.")
 
 	opts := helmchart.CheckResourceOptions{
-		DynamicClient:   h.dynamicClient,
-		DiscoveryClient: h.discoveryClient,
+		DynamicClient: h.dynamicClient,
+		Mapper:        h.mapper,
+	}
+
+	ref, err := checkResources(ctx, all, opts)
+	if apierrors.IsNotFound(err) {
+		// Objects deleted by hand are reinstalled.
+		log.Debug().Err(err).Str("package", pkg.URL).Msg("Composition resource missing.")
+		return controller.ExternalObservation{}, nil
 	}
+	if err != nil {
+		if ref == nil {
+			log.Warn().Err(err).
+				Str("package", pkg.URL).
+				Msg("Composition not ready.")
+			// The release is installed, its resources just need time.
+			return upToDate, nil
+		}
 
-	for _, el := range all {
-		log.Debug().Str("package", pkg.URL).Msgf("Checking for resource %s.", el.String())
+		_ = unstructuredtools.SetFailedObjectRef(mg, ref)
+		_ = unstructuredtools.SetCondition(mg, condition.Unavailable())
 
-		ref, err := helmchart.CheckResource(ctx, el, opts)
-		if err != nil {
-			if ref == nil {
-				log.Warn().Err(err).
-					Str("package", pkg.URL).
-					Msgf("Composition not ready due to: %s.", el.String())
-				return false, nil
-			}
+		return upToDate, tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
+		})
+	}
 
-			_ = unstructuredtools.SetFailedObjectRef(mg, ref)
-			_ = unstructuredtools.SetCondition(mg, condition.Unavailable())
+	log.Debug().Str("package", pkg.URL).Msg("Composition ready.")
 
-			return true, tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-				DiscoveryClient: h.discoveryClient,
-				DynamicClient:   h.dynamicClient,
+	drifts, err := helmchart.FindDrift(ctx, all, rel.Manifest, opts)
+	if err != nil {
+		log.Err(err).Msg("Checking composition resources for drift")
+		return controller.ExternalObservation{}, err
+	}
+	if len(drifts) > 0 {
+		diff = driftSummary(drifts)
+		log.Debug().Str("package", pkg.URL).Str("diff", diff).Msg("Composition drifted.")
+		_ = unstructuredtools.SetCondition(mg, condition.Drifted(diff))
+
+		if meta.IsAutoHeal(mg, pkg.AutoHeal) {
+			err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+				Mapper:        h.mapper,
+				DynamicClient: h.dynamicClient,
 			})
+			return controller.ExternalObservation{
+				ResourceExists:    true,
+				ResourceUpToDate:  false,
+				ConnectionDetails: upToDate.ConnectionDetails,
+				Diff:              diff,
+			}, err
 		}
+	} else {
+		_ = unstructuredtools.SetCondition(mg, condition.NoDrift())
 	}
 
-	log.Debug().Str("package", pkg.URL).Msg("Composition ready.")
-
 	if meta.ExternalCreateIncomplete(mg) {
+		// The release status and the drift condition set above are not
+		// written by the annotations patch.
+		err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
+		})
+		if err != nil {
+			log.Err(err).Msg("Updating cr status")
+			return controller.ExternalObservation{}, err
+		}
+
 		meta.RemoveAnnotations(mg, meta.AnnotationKeyExternalCreatePending)
 		meta.SetExternalCreateSucceeded(mg, time.Now())
-		return true, tools.Update(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		return upToDate, tools.PatchAnnotations(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
 	}
 
 	// fmt.Println("Update status")
 	_ = unstructuredtools.SetCondition(mg, condition.Available())
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 	if err != nil {
 		log.Err(err).Msgf("Updating cr status with condition: %v", condition.Available())
 	}
 
-	return true, err
+	return upToDate, err
+}
+
+// checkResources checks that the supplied rendered objects exist and are
+// available. It returns the error of the first object that is not, satisfying
+// apierrors.IsNotFound if the object is missing, along with its reference if
+// the object reports itself as not available.
+func checkResources(ctx context.Context, all []*unstructured.Unstructured, opts helmchart.CheckResourceOptions) (*controller.ObjectRef, error) {
+	for _, obj := range all {
+		el := helmchart.ObjectRefFor(obj)
+
+		ref, err := helmchart.CheckResource(ctx, el, opts)
+		if err != nil {
+			return ref, fmt.Errorf("%s: %w", el.String(), err)
+		}
+	}
+	return nil, nil
+}
+
+// driftSummary returns a human readable summary of the supplied drifts.
+func driftSummary(drifts []helmchart.Drift) string {
+	all := make([]string, 0, len(drifts))
+	for _, d := range drifts {
+		all = append(all, d.String())
+	}
+	return "live state differs from the release: " + strings.Join(all, ", ")
 }
 
 func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) error {
@@ -184,10 +288,14 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		if err != nil {
 			return err
 		}
-		return tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
+		if err != nil {
+			return err
+		}
+		return controller.ErrNotApplied
 	}
 
 	if h.packageInfoGetter == nil {
@@ -212,6 +320,12 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		Resource:   mg,
 		Repo:       pkg.Repo,
 		Version:    pkg.Version,
+		Labels:     helmchart.ReleaseLabels(mg, pkg.DeletionPolicy),
+	}
+	opts.Options, err = helmchart.ReleaseOptionsFor(mg, pkg.Install, meta.AnnotationKeyInstallOptions)
+	if err != nil {
+		log.Err(err).Msg("Getting install options")
+		return err
 	}
 	if pkg.RegistryAuth != nil {
 		opts.Credentials = &helmchart.Credentials{
@@ -224,17 +338,17 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 	if err != nil {
 		log.Err(err).Msgf("Installing helm chart: %s", pkg.URL)
 		meta.SetExternalCreateFailed(mg, time.Now())
-		_ = tools.Update(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		_ = tools.PatchAnnotations(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
 
 		unstructuredtools.SetCondition(mg, condition.FailWithReason(
 			fmt.Sprintf("Creating failed: %s", err.Error())))
 
-		_ = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		_ = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
 
 		return err
@@ -243,9 +357,9 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 	log.Debug().Str("package", pkg.URL).Msg("Installing composition package.")
 
 	meta.SetExternalCreatePending(mg, time.Now())
-	return tools.Update(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	return tools.PatchAnnotations(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 }
 
@@ -266,20 +380,14 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		log.Warn().Msg(errCreateIncomplete)
 		_ = unstructuredtools.SetCondition(mg, condition.Creating())
 
-		return tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		err := tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
-	}
-
-	meta.SetExternalCreatePending(mg, time.Now())
-	err := tools.Update(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
-	if err != nil {
-		log.Err(err).Msg("Setting meta create pending annotation.")
-		return err
+		if err != nil {
+			return err
+		}
+		return controller.ErrNotApplied
 	}
 
 	if h.packageInfoGetter == nil {
@@ -299,11 +407,25 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 	}
 
 	opts := helmchart.UpdateOptions{
-		HelmClient: hc,
-		ChartName:  pkg.URL,
-		Resource:   mg,
-		Repo:       pkg.Repo,
-		Version:    pkg.Version,
+		HelmClient:        hc,
+		ChartName:         pkg.URL,
+		Resource:          mg,
+		Repo:              pkg.Repo,
+		Version:           pkg.Version,
+		Labels:            helmchart.ReleaseLabels(mg, pkg.DeletionPolicy),
+		RollbackOnFailure: pkg.UpgradeStrategy.RollbackOnFailure,
+	}
+	opts.Options, err = helmchart.ReleaseOptionsFor(mg, pkg.Upgrade, meta.AnnotationKeyUpgradeOptions)
+	if err != nil {
+		log.Err(err).Msg("Getting upgrade options")
+		return err
+	}
+	if pkg.UpgradeStrategy.Timeout != "" {
+		opts.Timeout, err = time.ParseDuration(pkg.UpgradeStrategy.Timeout)
+		if err != nil {
+			log.Err(err).Msg("Parsing upgrade timeout")
+			return err
+		}
 	}
 	if pkg.RegistryAuth != nil {
 		opts.Credentials = &helmchart.Credentials{
@@ -312,9 +434,36 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		}
 	}
 
+	// Set right before upgrading, the errors above leaving the release untouched.
+	meta.SetExternalCreatePending(mg, time.Now())
+	err = tools.PatchAnnotations(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
+	})
+	if err != nil {
+		log.Err(err).Msg("Setting meta create pending annotation.")
+		return err
+	}
+
 	err = helmchart.Update(ctx, opts)
 	if err != nil {
 		log.Err(err).Msg("Performing helm chart update")
+
+		// Unblock the next update, the outcome of this one being known.
+		meta.SetExternalCreateFailed(mg, time.Now())
+		_ = tools.PatchAnnotations(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
+		})
+
+		var rerr *helmchart.RollbackError
+		if errors.As(err, &rerr) {
+			_ = setRollbackStatus(mg, rerr)
+			_ = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+				Mapper:        h.mapper,
+				DynamicClient: h.dynamicClient,
+			})
+		}
 		return err
 	}
 
@@ -322,6 +471,17 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 
 	return nil
 }
+
+// setRollbackStatus records the revisions involved in the supplied rollback.
+func setRollbackStatus(mg *unstructured.Unstructured, rerr *helmchart.RollbackError) error {
+	return unstructured.SetNestedMap(mg.Object, map[string]interface{}{
+		"failedRevision":   int64(rerr.FailedRevision),
+		"restoredRevision": int64(rerr.RestoredRevision),
+		"time":             time.Now().UTC().Format(time.RFC3339),
+		"message":          rerr.Err.Error(),
+	}, "status", "lastRollback")
+}
+
 func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
 	log := h.logger.With().
 		Str("op", "Delete").
@@ -341,11 +501,22 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	}
 
 	pkg, err := h.packageInfoGetter.Get(mg)
+	if errors.Is(err, archive.ErrDefinitionNotFound) {
+		// The definition may be gone before the resource,
+		// the release alone is enough to uninstall it.
+		log.Warn().Err(err).Msg("Uninstalling composition package without definition")
+		return h.uninstallRelease(mg)
+	}
 	if err != nil {
 		log.Err(err).Msg("Getting package info")
 		return err
 	}
 
+	if meta.GetDeletionPolicy(mg, pkg.DeletionPolicy) == meta.DeletionPolicyOrphan {
+		log.Debug().Str("package", pkg.URL).Msg("Deletion policy is Orphan, leaving composition package installed.")
+		return nil
+	}
+
 	hc, err := h.helmClientForResource(mg, pkg.RegistryAuth)
 	if err != nil {
 		return err
@@ -375,6 +546,38 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	return nil
 }
 
+// uninstallRelease uninstalls the release of the supplied resource relying on
+// the deletion policy recorded in the release labels. Releases installed for
+// another resource with the same name are left untouched.
+func (h *handler) uninstallRelease(mg *unstructured.Unstructured) error {
+	hc, err := h.helmClientForResource(mg, nil)
+	if err != nil {
+		return err
+	}
+
+	rel, err := hc.GetRelease(mg.GetName())
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if id := rel.Labels[helmchart.LabelCompositionID]; id != "" && mg.GetUID() != "" && id != string(mg.GetUID()) {
+		return nil
+	}
+	if meta.GetDeletionPolicy(mg, rel.Labels[helmchart.LabelDeletionPolicy]) == meta.DeletionPolicyOrphan {
+		return nil
+	}
+
+	return hc.UninstallRelease(&helmclient.ChartSpec{
+		ReleaseName: mg.GetName(),
+		Namespace:   mg.GetNamespace(),
+		Wait:        true,
+		Timeout:     time.Minute * 3,
+	})
+}
+
 // func (h *handler) Delete(ctx context.Context, ref controller.ObjectRef) error {
 // 	if h.packageInfoGetter == nil {
 // 		return fmt.Errorf("helm chart package info getter must be specified")
@@ -420,6 +623,41 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 // 	return nil
 // }
 
+// ListExternal returns the last known state of the managed resources of the
+// supplied resource type owning a release in namespace, rebuilt from the
+// release labels. Releases installed by previous versions are not listed.
+func (h *handler) ListExternal(ctx context.Context, gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error) {
+	gvk, err := h.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := helmclient.New(&helmclient.Options{
+		Namespace:        namespace,
+		AllNamespaces:    namespace == "",
+		RepositoryCache:  "/tmp/.helmcache",
+		RepositoryConfig: "/tmp/.helmrepo",
+		Linting:          false,
+		DebugLog:         func(format string, v ...interface{}) {},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := hc.ListReleasesByStateMask(action.ListAll)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*unstructured.Unstructured{}
+	for _, rel := range all {
+		if el, ok := helmchart.ManagedResource(rel, gvk.GroupKind()); ok {
+			res = append(res, el)
+		}
+	}
+	return res, nil
+}
+
 func (h *handler) helmClientForResource(mg *unstructured.Unstructured, registryAuth *helmclient.RegistryAuth) (helmclient.Client, error) {
 	log := h.logger.With().
 		Str("apiVersion", mg.GetAPIVersion()).
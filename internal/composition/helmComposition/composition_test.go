@@ -0,0 +1,82 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestCheckResources(t *testing.T) {
+	configMap := func(name string, conditions ...interface{}) *unstructured.Unstructured {
+		el := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "demo-system",
+			},
+		}}
+		if len(conditions) > 0 {
+			_ = unstructured.SetNestedSlice(el.Object, conditions, "status", "conditions")
+		}
+		return el
+	}
+
+	notReady := configMap("not-ready", map[string]interface{}{
+		"type":   "Ready",
+		"status": "False",
+		"reason": "Pending",
+	})
+
+	tests := []struct {
+		name     string
+		rendered []*unstructured.Unstructured
+		ref      *controller.ObjectRef
+		notFound bool
+		err      bool
+	}{
+		{
+			name:     "available",
+			rendered: []*unstructured.Unstructured{configMap("one"), configMap("two")},
+		},
+		{
+			name:     "deleted by hand",
+			rendered: []*unstructured.Unstructured{configMap("one"), configMap("deleted")},
+			notFound: true,
+			err:      true,
+		},
+		{
+			name:     "not available",
+			rendered: []*unstructured.Unstructured{configMap("one"), notReady},
+			ref:      &controller.ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Name: "not-ready", Namespace: "demo-system"},
+			err:      true,
+		},
+	}
+
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, apimeta.RESTScopeNamespace)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := helmchart.CheckResourceOptions{
+				DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+					configMap("one"), configMap("two"), notReady),
+				Mapper: mapper,
+			}
+
+			ref, err := checkResources(context.TODO(), tc.rendered, opts)
+			assert.Equal(t, tc.err, err != nil)
+			assert.Equal(t, tc.notFound, apierrors.IsNotFound(err))
+			assert.Equal(t, tc.ref, ref)
+		})
+	}
+}
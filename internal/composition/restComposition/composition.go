@@ -4,11 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-
-	"github.com/gobuffalo/flect"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
@@ -21,30 +17,26 @@ import (
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 )
 
-var _ controller.ExternalClient = (*handler)(nil)
+var (
+	_ controller.ExternalClient = (*handler)(nil)
+)
 
-func NewHandler(cfg *rest.Config, log *zerolog.Logger, swg getter.Getter) controller.ExternalClient {
+func NewHandler(cfg *rest.Config, mapper apimeta.RESTMapper, log *zerolog.Logger, swg getter.Getter) controller.ExternalClient {
 	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Creating dynamic client.")
 	}
 
-	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating discovery client.")
-	}
-
 	return &handler{
 		logger:            log,
 		dynamicClient:     dyn,
-		discoveryClient:   dis,
+		mapper:            mapper,
 		swaggerInfoGetter: swg,
 	}
 }
@@ -52,11 +44,11 @@ func NewHandler(cfg *rest.Config, log *zerolog.Logger, swg getter.Getter) contro
 type handler struct {
 	logger            *zerolog.Logger
 	dynamicClient     dynamic.Interface
-	discoveryClient   *discovery.DiscoveryClient
+	mapper            apimeta.RESTMapper
 	swaggerInfoGetter getter.Getter
 }
 
-func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
+func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (obs controller.ExternalObservation, err error) {
 	log := h.logger.With().Timestamp().
 		Str("op", "Observe").
 		Str("apiVersion", mg.GetAPIVersion()).
@@ -64,26 +56,30 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		Str("name", mg.GetName()).
 		Str("namespace", mg.GetNamespace()).Logger()
 
+	upToDate := controller.ExternalObservation{
+		ResourceExists:   true,
+		ResourceUpToDate: true,
+	}
+
 	if h.swaggerInfoGetter == nil {
-		return false, fmt.Errorf("swagger file info getter must be specified")
+		return controller.ExternalObservation{}, fmt.Errorf("swagger file info getter must be specified")
 	}
 	clientInfo, err := h.swaggerInfoGetter.Get(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting REST client info")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
 	if clientInfo == nil {
-		return false, fmt.Errorf("swagger info is nil")
+		return controller.ExternalObservation{}, fmt.Errorf("swagger info is nil")
 	}
-	tools.Update(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
+	defer func() {
+		obs.PollInterval = clientInfo.PollInterval
+	}()
 
 	cli, err := restclient.BuildClient(clientInfo.URL)
 	if err != nil {
 		log.Err(err).Msg("Building REST client")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
 	cli.Auth = clientInfo.Auth
 	cli.Verbose = meta.IsVerbose(mg)
@@ -92,7 +88,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 	specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
 	if err != nil {
 		log.Err(err).Msg("Getting spec")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
 	statusFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "status")
 	if err != nil {
@@ -106,31 +102,31 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.Get)
 		if apiCall == nil {
 			log.Warn().Msgf("API call not found for %s", apiaction.Get)
-			return true, nil
+			return upToDate, nil
 		}
 		if err != nil {
 			log.Err(err).Msg("Building API call")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 		reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
 		if reqConfiguration == nil {
-			return false, fmt.Errorf("error building call configuration")
+			return controller.ExternalObservation{}, fmt.Errorf("error building call configuration")
 		}
 		body, err = apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
 		if httplib.IsNotFoundError(err) {
 			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not found.")
-			return false, nil
+			return controller.ExternalObservation{}, nil
 		}
 		if err != nil {
 			log.Err(err).Msg("Performing REST call")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 	} else {
 		apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.FindBy)
 		if apiCall == nil {
 			if !unstructuredtools.IsConditionSet(mg, condition.Creating()) && !unstructuredtools.IsConditionSet(mg, condition.Available()) {
 				log.Debug().Str("Resource", mg.GetKind()).Msg("External resource is being created.")
-				return false, nil
+				return controller.ExternalObservation{}, nil
 			}
 			log.Warn().Msgf("API call not found for %s", apiaction.FindBy)
 			log.Warn().Msgf("Resource is assumed to be up-to-date.")
@@ -139,78 +135,82 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 			err = unstructuredtools.SetCondition(mg, cond)
 			if err != nil {
 				log.Err(err).Msg("Setting condition")
-				return false, err
+				return controller.ExternalObservation{}, err
 			}
-			return true, tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-				DiscoveryClient: h.discoveryClient,
-				DynamicClient:   h.dynamicClient,
+			return upToDate, tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+				Mapper:        h.mapper,
+				DynamicClient: h.dynamicClient,
 			})
 		}
 		if err != nil {
 			log.Err(err).Msg("Building API call")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 		reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
 		if reqConfiguration == nil {
-			return false, fmt.Errorf("error building call configuration")
+			return controller.ExternalObservation{}, fmt.Errorf("error building call configuration")
 		}
 		body, err = apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
 		if httplib.IsNotFoundError(err) {
 			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not found.")
-			return false, nil
+			return controller.ExternalObservation{}, nil
 		}
 		if err != nil {
 			log.Err(err).Msg("Performing REST call")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 	}
 
 	if body != nil {
+		upToDate.ConnectionDetails = connectionDetails(clientInfo.Resource.ConnectionDetails, *body)
+
 		err = populateStatusFields(clientInfo, mg, body)
 		if err != nil {
 			log.Err(err).Msg("Updating identifiers")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 
-		err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
+		err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+			Mapper:        h.mapper,
+			DynamicClient: h.dynamicClient,
 		})
 		if err != nil {
 			log.Err(err).Msg("Updating status")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
-		ok, err := isCRUpdated(mg, *body)
+		ok, diff, err := isCRUpdated(mg, *body)
 		if err != nil {
 			log.Err(err).Msg("Checking if CR is updated")
-			return false, err
+			return controller.ExternalObservation{}, err
 		}
 		if !ok {
 			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not up-to-date.")
-			return true, apierrors.NewNotFound(schema.GroupResource{
-				Group:    mg.GroupVersionKind().Group,
-				Resource: flect.Pluralize(strings.ToLower(mg.GetKind())),
-			}, mg.GetName())
+			return controller.ExternalObservation{
+				ResourceExists:    true,
+				ResourceUpToDate:  false,
+				ConnectionDetails: upToDate.ConnectionDetails,
+				Diff:              fmt.Sprintf("external resource differs from %s", diff),
+			}, nil
 		}
 	}
 	log.Debug().Str("Resource", mg.GetKind()).Msg("Setting condition.")
 	err = unstructuredtools.SetCondition(mg, condition.Available())
 	if err != nil {
 		log.Err(err).Msg("Setting condition")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 	if err != nil {
 		log.Err(err).Msg("Updating status")
-		return false, err
+		return controller.ExternalObservation{}, err
 	}
 
 	log.Debug().Str("Resource", mg.GetKind()).Msg("External resource up-to-date.")
 
-	return true, nil
+	return upToDate, nil
 }
 
 func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) error {
@@ -270,9 +270,9 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 	if err != nil {
 		log.Err(err).Msg("Updating status")
@@ -346,18 +346,18 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 	if err != nil {
 		log.Err(err).Msg("Updating status")
 		return err
 	}
 
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
+	err = tools.PatchStatus(ctx, mg, tools.UpdateOptions{
+		Mapper:        h.mapper,
+		DynamicClient: h.dynamicClient,
 	})
 	if err != nil {
 		log.Err(err).Msg("Updating status")
@@ -388,6 +388,14 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		log.Err(err).Msg("Getting REST client info")
 		return err
 	}
+	if clientInfo == nil {
+		return fmt.Errorf("swagger info is nil")
+	}
+
+	if meta.GetDeletionPolicy(mg, clientInfo.DeletionPolicy) == meta.DeletionPolicyOrphan {
+		log.Debug().Str("Resource", mg.GetKind()).Msg("Deletion policy is Orphan, leaving external resource untouched.")
+		return nil
+	}
 
 	cli, err := restclient.BuildClient(clientInfo.URL)
 	if err != nil {
@@ -410,7 +418,7 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.Delete)
 	if apiCall == nil {
 		log.Warn().Msgf("API call not found for %s", apiaction.Delete)
-		return removeFinalizersAndUpdate(ctx, log, h.discoveryClient, h.dynamicClient, mg)
+		return nil
 	}
 	if err != nil {
 		log.Err(err).Msg("Building API call")
@@ -427,13 +435,7 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	log.Debug().Str("Resource", mg.GetKind()).Msg("Deleting external resource.")
+	log.Debug().Str("Resource", mg.GetKind()).Msg("External resource deleted.")
 
-	err = unstructuredtools.SetCondition(mg, condition.Deleting())
-	if err != nil {
-		log.Err(err).Msg("Setting condition")
-		return err
-	}
-
-	return removeFinalizersAndUpdate(ctx, log, h.discoveryClient, h.dynamicClient, mg)
+	return nil
 }
@@ -2,22 +2,21 @@ package composition
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
-	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/apiaction"
 	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/dynamic"
 )
 
 type RequestedParams struct {
@@ -128,17 +127,20 @@ func processFields(callInfo *CallInfo, fields map[string]interface{}, reqConfigu
 }
 
 // isCRUpdated checks if the CR was updated by comparing the fields in the CR with the response from the API call, if existing cr fields are different from the response, it returns false
-func isCRUpdated(mg *unstructured.Unstructured, rm map[string]interface{}) (bool, error) {
+// along with the path of the first field that differs.
+func isCRUpdated(mg *unstructured.Unstructured, rm map[string]interface{}) (bool, string, error) {
 	m, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
 	if err != nil {
-		return false, fmt.Errorf("error getting spec fields: %w", err)
+		return false, "", fmt.Errorf("error getting spec fields: %w", err)
 	}
 
-	return compareExisting(m, rm), nil
+	path, ok := compareExisting(m, rm, "spec")
+	return ok, path, nil
 }
 
 // compareExisting recursively compares fields between two maps and logs differences.
-func compareExisting(mg map[string]interface{}, rm map[string]interface{}, path ...string) bool {
+// It returns the dot separated path of the first field that differs.
+func compareExisting(mg map[string]interface{}, rm map[string]interface{}, path ...string) (string, bool) {
 	for key, value := range mg {
 		currentPath := append(path, key)
 		pathStr := fmt.Sprintf("%v", currentPath)
@@ -160,9 +162,9 @@ func compareExisting(mg map[string]interface{}, rm map[string]interface{}, path
 				fmt.Printf("Type assertion failed for map at '%s'\n", pathStr)
 				continue
 			}
-			if !compareExisting(mgMap, rmMap, currentPath...) {
+			if diff, ok := compareExisting(mgMap, rmMap, currentPath...); !ok {
 				fmt.Printf("Values differ at '%s'\n", pathStr)
-				return false
+				return diff, false
 			}
 		case reflect.Slice:
 			valueSlice, ok1 := value.([]interface{})
@@ -176,6 +178,11 @@ func compareExisting(mg map[string]interface{}, rm map[string]interface{}, path
 				continue
 			}
 			for i, v := range valueSlice {
+				itemPath := append(currentPath[:len(currentPath)-1:len(currentPath)-1], fmt.Sprintf("%s[%d]", key, i))
+				if i >= len(rmSlice) {
+					fmt.Printf("Values differ at '%s'\n", pathStr)
+					return strings.Join(itemPath, "."), false
+				}
 				if reflect.TypeOf(v).Kind() == reflect.Map {
 					mgMap, ok1 := v.(map[string]interface{})
 					if !ok1 {
@@ -187,24 +194,24 @@ func compareExisting(mg map[string]interface{}, rm map[string]interface{}, path
 						fmt.Printf("Type assertion failed for map at '%s'\n", pathStr)
 						continue
 					}
-					if !compareExisting(mgMap, rmMap, currentPath...) {
+					if diff, ok := compareExisting(mgMap, rmMap, itemPath...); !ok {
 						fmt.Printf("Values differ at '%s'\n", pathStr)
-						return false
+						return diff, false
 					}
 				} else if v != rmSlice[i] {
 					fmt.Printf("Values differ at '%s'\n", pathStr)
-					return false
+					return strings.Join(itemPath, "."), false
 				}
 			}
 		default:
 			if !compareAny(value, rmValue) {
 				fmt.Printf("Values differ at '%s' %s %s\n", pathStr, value, rmValue)
-				return false
+				return strings.Join(currentPath, "."), false
 			}
 		}
 	}
 
-	return true
+	return "", true
 }
 func numberCaster(value interface{}) int64 {
 	switch v := value.(type) {
@@ -257,19 +264,6 @@ func compareAny(a any, b any) bool {
 	}
 }
 
-func removeFinalizersAndUpdate(ctx context.Context, log zerolog.Logger, discovery *discovery.DiscoveryClient, dynamic dynamic.Interface, mg *unstructured.Unstructured) error {
-	mg.SetFinalizers([]string{})
-	err := tools.Update(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: discovery,
-		DynamicClient:   dynamic,
-	})
-	if err != nil {
-		log.Err(err).Msg("Deleting finalizer")
-		return err
-	}
-	return nil
-}
-
 // populateStatusFields populates the status fields in the mg object with the values from the body
 func populateStatusFields(clientInfo *getter.Info, mg *unstructured.Unstructured, body *map[string]interface{}) error {
 	if body != nil {
@@ -312,3 +306,34 @@ func isResourceKnown(cli *restclient.UnstructuredClient, log zerolog.Logger, cli
 
 	return cli.ValidateRequest(actionGetMethod, callInfo.Path, reqConfiguration.Parameters, reqConfiguration.Query) == nil
 }
+
+// connectionDetails extracts the selected fields of the response body, the nested ones are JSON encoded
+func connectionDetails(details []getter.ConnectionDetail, body map[string]interface{}) controller.ConnectionDetails {
+	if len(details) == 0 {
+		return nil
+	}
+
+	res := controller.ConnectionDetails{}
+	for _, cd := range details {
+		if cd.Name == "" || cd.Path == "" {
+			continue
+		}
+
+		val, ok, err := unstructured.NestedFieldNoCopy(body, strings.Split(cd.Path, ".")...)
+		if err != nil || !ok || val == nil {
+			continue
+		}
+
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			dat, err := json.Marshal(val)
+			if err != nil {
+				continue
+			}
+			res[cd.Name] = dat
+		default:
+			res[cd.Name] = []byte(text.GenericToString(val))
+		}
+	}
+	return res
+}
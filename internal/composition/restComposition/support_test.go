@@ -0,0 +1,127 @@
+package composition
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIsCRUpdated(t *testing.T) {
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"name":  "demo",
+			"owner": map[string]interface{}{"id": int64(42)},
+			"tags":  []interface{}{"a", "b"},
+		},
+	}}
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		ok   bool
+		diff string
+	}{
+		{
+			name: "up-to-date",
+			body: map[string]interface{}{
+				"name":    "demo",
+				"owner":   map[string]interface{}{"id": float64(42)},
+				"tags":    []interface{}{"a", "b"},
+				"created": "2024-06-01",
+			},
+			ok: true,
+		},
+		{
+			name: "field differs",
+			body: map[string]interface{}{"name": "other"},
+			diff: "spec.name",
+		},
+		{
+			name: "nested field differs",
+			body: map[string]interface{}{"owner": map[string]interface{}{"id": float64(7)}},
+			diff: "spec.owner.id",
+		},
+		{
+			name: "item differs",
+			body: map[string]interface{}{"tags": []interface{}{"a", "c"}},
+			diff: "spec.tags[1]",
+		},
+		{
+			name: "item missing",
+			body: map[string]interface{}{"tags": []interface{}{"a"}},
+			diff: "spec.tags[1]",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, diff, err := isCRUpdated(mg, tc.body)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.diff, diff)
+		})
+	}
+}
+
+func TestConnectionDetails(t *testing.T) {
+	body := map[string]interface{}{
+		"id":   float64(42),
+		"host": "db.example.org",
+		"credentials": map[string]interface{}{
+			"token":  "s3cr3t",
+			"scopes": []interface{}{"read", "write"},
+		},
+		"empty": nil,
+	}
+
+	tests := []struct {
+		name    string
+		details []getter.ConnectionDetail
+		want    controller.ConnectionDetails
+	}{
+		{
+			name: "none requested",
+		},
+		{
+			name: "scalars",
+			details: []getter.ConnectionDetail{
+				{Name: "host", Path: "host"},
+				{Name: "id", Path: "id"},
+				{Name: "token", Path: "credentials.token"},
+			},
+			want: controller.ConnectionDetails{
+				"host":  []byte("db.example.org"),
+				"id":    []byte("42"),
+				"token": []byte("s3cr3t"),
+			},
+		},
+		{
+			name: "nested fields are JSON encoded",
+			details: []getter.ConnectionDetail{
+				{Name: "scopes", Path: "credentials.scopes"},
+			},
+			want: controller.ConnectionDetails{
+				"scopes": []byte(`["read","write"]`),
+			},
+		},
+		{
+			name: "missing, null and incomplete ones are skipped",
+			details: []getter.ConnectionDetail{
+				{Name: "missing", Path: "credentials.password"},
+				{Name: "empty", Path: "empty"},
+				{Name: "", Path: "host"},
+				{Name: "host"},
+			},
+			want: controller.ConnectionDetails{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, connectionDetails(tc.details, body))
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var secretsGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// connectionSecretRef returns the name of the Secret the connection details
+// of the supplied object are published to, if any. The Secret must live in
+// the namespace of the object, so that creating an object does not grant
+// write access to the Secrets of other namespaces.
+func connectionSecretRef(el *unstructured.Unstructured) (name string, ok bool, err error) {
+	name, _, _ = unstructured.NestedString(el.Object, "spec", "writeConnectionSecretToRef", "name")
+	if name == "" {
+		return "", false, nil
+	}
+
+	namespace, _, _ := unstructured.NestedString(el.Object, "spec", "writeConnectionSecretToRef", "namespace")
+	if namespace != "" && namespace != el.GetNamespace() {
+		return "", false, fmt.Errorf("connection secret '%s/%s' must be in namespace '%s'", namespace, name, el.GetNamespace())
+	}
+	return name, true, nil
+}
+
+// ownedBy returns true if the supplied object is owned by owner.
+func ownedBy(obj, owner *unstructured.Unstructured) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// publishConnectionDetails applies the supplied connection details to the
+// Secret referenced by the object, removing the keys that are not there anymore.
+// The Secret is created and owned by the object, so that it is garbage
+// collected with it; Secrets owned by anything else are never overwritten.
+func (c *Controller) publishConnectionDetails(ctx context.Context, el *unstructured.Unstructured, details ConnectionDetails) error {
+	name, ok, err := connectionSecretRef(el)
+	if err != nil || !ok {
+		return err
+	}
+	if el.GetUID() == "" {
+		return nil
+	}
+
+	cli := c.dynamicClient.Resource(secretsGVR).Namespace(el.GetNamespace())
+
+	cur, err := cli.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if len(details) == 0 {
+			return nil
+		}
+	case err != nil:
+		return fmt.Errorf("getting connection secret '%s/%s': %w", el.GetNamespace(), name, err)
+	case !ownedBy(cur, el):
+		return fmt.Errorf("connection secret '%s/%s' exists and is not owned by %s '%s'",
+			el.GetNamespace(), name, el.GetKind(), el.GetName())
+	}
+
+	sec := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	sec.SetAPIVersion("v1")
+	sec.SetKind("Secret")
+	sec.SetName(name)
+	sec.SetNamespace(el.GetNamespace())
+	// Applying all the details every time drops the stale keys.
+	if err := unstructured.SetNestedField(sec.Object, encodeSecretData(details), "data"); err != nil {
+		return err
+	}
+
+	isController := true
+	sec.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: el.GetAPIVersion(),
+		Kind:       el.GetKind(),
+		Name:       el.GetName(),
+		UID:        el.GetUID(),
+		Controller: &isController,
+	}})
+
+	_, err = cli.Apply(ctx, name, sec, metav1.ApplyOptions{FieldManager: tools.FieldManager, Force: true})
+	if err != nil {
+		return fmt.Errorf("publishing connection details to secret '%s/%s': %w", el.GetNamespace(), name, err)
+	}
+	return nil
+}
+
+// encodeSecretData returns the supplied details as the base64 encoded data of a Secret.
+func encodeSecretData(details ConnectionDetails) map[string]interface{} {
+	res := make(map[string]interface{}, len(details))
+	for k, v := range details {
+		res[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newSecret(name string, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+	sec := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+		},
+		"data": map[string]interface{}{"stale": "eA=="},
+	}}
+	sec.SetOwnerReferences(owners)
+	return sec
+}
+
+func TestPublishConnectionDetails(t *testing.T) {
+	newOwner := func(ref map[string]interface{}) *unstructured.Unstructured {
+		el := newObject("demo")
+		el.SetUID("1234")
+		if ref != nil {
+			_ = unstructured.SetNestedMap(el.Object, ref, "spec", "writeConnectionSecretToRef")
+		}
+		return el
+	}
+
+	tests := []struct {
+		name    string
+		el      *unstructured.Unstructured
+		secrets []*unstructured.Unstructured
+		details ConnectionDetails
+		err     bool
+		applied map[string]interface{}
+	}{
+		{
+			name:    "no reference",
+			el:      newOwner(nil),
+			details: ConnectionDetails{"token": []byte("x")},
+		},
+		{
+			name:    "other namespace",
+			el:      newOwner(map[string]interface{}{"name": "conn", "namespace": "kube-system"}),
+			details: ConnectionDetails{"token": []byte("x")},
+			err:     true,
+		},
+		{
+			name:    "created",
+			el:      newOwner(map[string]interface{}{"name": "conn"}),
+			details: ConnectionDetails{"token": []byte("x")},
+			applied: map[string]interface{}{"token": "eA=="},
+		},
+		{
+			name: "nothing to create",
+			el:   newOwner(map[string]interface{}{"name": "conn", "namespace": "default"}),
+		},
+		{
+			name:    "stale keys cleared",
+			el:      newOwner(map[string]interface{}{"name": "conn"}),
+			secrets: []*unstructured.Unstructured{newSecret("conn", metav1.OwnerReference{UID: "1234"})},
+			applied: map[string]interface{}{},
+		},
+		{
+			name:    "not owned",
+			el:      newOwner(map[string]interface{}{"name": "conn"}),
+			secrets: []*unstructured.Unstructured{newSecret("conn", metav1.OwnerReference{UID: "5678"})},
+			details: ConnectionDetails{"token": []byte("x")},
+			err:     true,
+		},
+		{
+			name:    "not owned at all",
+			el:      newOwner(map[string]interface{}{"name": "conn"}),
+			secrets: []*unstructured.Unstructured{newSecret("conn")},
+			details: ConnectionDetails{"token": []byte("x")},
+			err:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestController(t, &fakeClient{}, tc.secrets)
+
+			var applied map[string]interface{}
+			cli := c.dynamicClient.(*dynamicfake.FakeDynamicClient)
+			cli.PrependReactor("patch", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				sec := &unstructured.Unstructured{}
+				if err := json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &sec.Object); err != nil {
+					return true, nil, err
+				}
+				assert.True(t, ownedBy(sec, tc.el))
+				applied, _, _ = unstructured.NestedMap(sec.Object, "data")
+				if applied == nil {
+					applied = map[string]interface{}{}
+				}
+				return true, sec, nil
+			})
+
+			err := c.publishConnectionDetails(context.TODO(), tc.el, tc.details)
+			assert.Equal(t, tc.err, err != nil, err)
+			assert.Equal(t, tc.applied, applied)
+		})
+	}
+}
@@ -3,17 +3,17 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	"github.com/gobuffalo/flect"
-	"github.com/google/go-cmp/cmp"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/listwatcher"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/metrics"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
 	"github.com/rs/zerolog"
 	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -24,228 +24,335 @@ import (
 	"k8s.io/client-go/util/workqueue"
 )
 
+// cancelTimeout is how long cancelled reconciles are waited for on shutdown.
+const cancelTimeout = 5 * time.Second
+
 type Options struct {
-	Client         dynamic.Interface
-	GVR            schema.GroupVersionResource
-	Namespace      string
+	Client dynamic.Interface
+	GVR    schema.GroupVersionResource
+	// GVRs are additional resources watched by the controller,
+	// all sharing the same workqueue and workers.
+	GVRs []schema.GroupVersionResource
+	// Namespaces are the namespaces watched by the controller,
+	// all namespaces if empty.
+	Namespaces []string
+	// LabelSelector and FieldSelector restrict the watched objects,
+	// e.g. to shard them across several controllers.
+	LabelSelector  string
+	FieldSelector  string
 	ResyncInterval time.Duration
 	Recorder       record.EventRecorder
 	Logger         *zerolog.Logger
 	ExternalClient ExternalClient
+	ClientType     client.ClientType
+	// Elected, when set, delays the start of the workers until it is closed.
+	// Informers run anyway, so that caches are warm on leadership change.
+	Elected <-chan struct{}
+	// StallTimeout is the period after which the controller is considered
+	// not healthy if workers have not dequeued anything while the queue is not empty.
+	StallTimeout time.Duration
+	// SweepInterval is the period the external resources left behind by
+	// managed resources that vanished unnoticed are looked for with.
+	// Zero disables the sweep, which also requires an ExternalClient
+	// implementing OrphanLister.
+	SweepInterval time.Duration
+	// ShutdownGracePeriod is how long in-flight reconciles are waited for
+	// on shutdown before being cancelled.
+	ShutdownGracePeriod time.Duration
+	// Retry is the policy failed events are retried with.
+	// Zero values fall back to the defaults.
+	Retry RetryPolicy
 }
 
 type Controller struct {
 	dynamicClient  dynamic.Interface
-	gvr            schema.GroupVersionResource
+	namespaces     []string
+	labelSelector  string
+	fieldSelector  string
+	resyncInterval time.Duration
+	sid            *shortid.Shortid
 	queue          workqueue.RateLimitingInterface
-	indexer        cache.Indexer
-	informer       cache.Controller
+	mu             sync.RWMutex
+	ctx            context.Context
+	resources      map[schema.GroupVersionResource]*resource
 	recorder       record.EventRecorder
 	logger         *zerolog.Logger
 	externalClient ExternalClient
+	clientType     client.ClientType
+	elected        <-chan struct{}
+	stallTimeout   time.Duration
+	retry          RetryPolicy
+	deadLetters    sync.Map
+	tombstones     sync.Map
+	released       sync.Map
+	orphanLister   OrphanLister
+	pollIntervals  sync.Map
+	gracePeriod    time.Duration
+	stopping       atomic.Bool
+	inflight       atomic.Int64
+	abandoned      atomic.Int64
+	sweepInterval  time.Duration
+	synced         atomic.Bool
+	running        atomic.Bool
+	lastDequeue    atomic.Int64
 }
 
 // New creates a new Controller.
 func New(sid *shortid.Shortid, opts Options) *Controller {
+	retry := opts.Retry.withDefaults()
+
 	rateLimiter := workqueue.NewMaxOfRateLimiter(
-		workqueue.NewItemExponentialFailureRateLimiter(3*time.Second, 180*time.Second),
+		workqueue.NewItemExponentialFailureRateLimiter(retry.MinBackoff, retry.MaxBackoff),
 		// 10 qps, 100 bucket size.  This is only for retry speed and its only the overall factor (not per item)
 		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
 	)
 
-	queue := workqueue.NewRateLimitingQueue(rateLimiter)
+	queue := workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{
+		Name:            "compositions",
+		MetricsProvider: metrics.QueueMetricsProvider(),
+	})
+
+	c := &Controller{
+		dynamicClient:  opts.Client,
+		namespaces:     opts.Namespaces,
+		labelSelector:  opts.LabelSelector,
+		fieldSelector:  opts.FieldSelector,
+		resyncInterval: opts.ResyncInterval,
+		sid:            sid,
+		recorder:       opts.Recorder,
+		logger:         opts.Logger,
+		queue:          queue,
+		resources:      map[schema.GroupVersionResource]*resource{},
+		clientType:     opts.ClientType,
+		elected:        opts.Elected,
+		stallTimeout:   opts.StallTimeout,
+		retry:          retry,
+		sweepInterval:  opts.SweepInterval,
+		gracePeriod:    opts.ShutdownGracePeriod,
+	}
+	if len(c.namespaces) == 0 {
+		c.namespaces = []string{metav1.NamespaceAll}
+	}
+	c.SetExternalClient(opts.ExternalClient)
+
+	gvrs := opts.GVRs
+	if !opts.GVR.Empty() {
+		gvrs = append([]schema.GroupVersionResource{opts.GVR}, gvrs...)
+	}
 
-	indexer, informer := cache.NewIndexerInformer(
+	for _, gvr := range gvrs {
+		c.AddResource(gvr)
+	}
+
+	return c
+}
+
+// objectRef returns the queue key of the supplied object.
+func objectRef(el *unstructured.Unstructured, gvr schema.GroupVersionResource) ObjectRef {
+	return ObjectRef{
+		APIVersion: el.GetAPIVersion(),
+		Kind:       el.GetKind(),
+		Name:       el.GetName(),
+		Namespace:  el.GetNamespace(),
+		Resource:   gvr.Resource,
+	}
+}
+
+// newInformer creates the informer that enqueues the events of the supplied resource in namespace.
+func (c *Controller) newInformer(gvr schema.GroupVersionResource, namespace string) (cache.Indexer, cache.Controller) {
+	return cache.NewIndexerInformer(
 		listwatcher.Create(listwatcher.CreateOptions{
-			Client:    opts.Client,
-			GVR:       opts.GVR,
-			Namespace: opts.Namespace,
+			Client:        c.dynamicClient,
+			GVR:           gvr,
+			Namespace:     namespace,
+			LabelSelector: c.labelSelector,
+			FieldSelector: c.fieldSelector,
 		}),
 		&unstructured.Unstructured{},
-		opts.ResyncInterval,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				el, ok := obj.(*unstructured.Unstructured)
-				if !ok {
-					opts.Logger.Warn().Msg("AddFunc: object is not an unstructured.")
-					return
-				}
-
-				id, err := sid.Generate()
-				if err != nil {
-					opts.Logger.Error().Err(err).Msg("AddFunc: generating short id.")
-					return
-				}
-				gvr := schema.GroupVersionResource{
-					Group:    el.GroupVersionKind().Group,
-					Version:  strings.Split(el.GetAPIVersion(), "/")[1],
-					Resource: strings.ToLower(flect.Pluralize(el.GetKind())),
-				}
-
-				if len(el.GetFinalizers()) == 0 {
-					el.SetFinalizers(append(el.GetFinalizers(), "composition.krateo.io/finalizer"))
-				}
-
-				_, err = opts.Client.Resource(gvr).Namespace(el.GetNamespace()).Update(context.Background(), el, metav1.UpdateOptions{})
-				if err != nil {
-					opts.Logger.Error().Err(err).Msg("AddFunc: updating object finalizer.")
-					return
-				}
-
-				queue.Add(event{
-					id:        id,
-					eventType: Observe,
-					objectRef: ObjectRef{
-						APIVersion: el.GetAPIVersion(),
-						Kind:       el.GetKind(),
-						Name:       el.GetName(),
-						Namespace:  el.GetNamespace(),
-					},
-				})
-			},
-			UpdateFunc: func(old, new interface{}) {
-				oldUns, ok := old.(*unstructured.Unstructured)
-				if !ok {
-					opts.Logger.Warn().Msg("UpdateFunc: object is not an unstructured.")
-					return
-				}
-
-				newUns, ok := new.(*unstructured.Unstructured)
-				if !ok {
-					opts.Logger.Warn().Msg("UpdateFunc: object is not an unstructured.")
-					return
-				}
-
-				id, err := sid.Generate()
-				if err != nil {
-					opts.Logger.Error().Err(err).Msg("UpdateFunc: generating short id.")
-					return
-				}
-
-				if newUns.GetDeletionTimestamp() != nil {
-					queue.Add(event{
-						id:        id,
-						eventType: Delete,
-						objectRef: ObjectRef{
-							APIVersion: newUns.GetAPIVersion(),
-							Kind:       newUns.GetKind(),
-							Name:       newUns.GetName(),
-							Namespace:  newUns.GetNamespace(),
-						},
-					})
-				}
-
-				newSpec, _, err := unstructured.NestedMap(newUns.Object, "spec")
-				if err != nil {
-					opts.Logger.Error().Err(err).Msg("UpdateFunc: getting new object spec.")
-					return
-				}
-
-				oldSpec, _, err := unstructured.NestedMap(oldUns.Object, "spec")
-				if err != nil {
-					opts.Logger.Error().Err(err).Msg("UpdateFunc: getting old object spec.")
-				}
-
-				diff := cmp.Diff(newSpec, oldSpec)
-				opts.Logger.Debug().Str("diff", diff).Msg("UpdateFunc: comparing current spec with desired spec")
-
-				if len(diff) > 0 {
-					queue.Add(event{
-						id:        id,
-						eventType: Update,
-						objectRef: ObjectRef{
-							APIVersion: newUns.GetAPIVersion(),
-							Kind:       newUns.GetKind(),
-							Name:       newUns.GetName(),
-							Namespace:  newUns.GetNamespace(),
-						},
-					})
-				} else {
-					queue.AddAfter(event{
-						id:        id,
-						eventType: Observe,
-						objectRef: ObjectRef{
-							APIVersion: newUns.GetAPIVersion(),
-							Kind:       newUns.GetKind(),
-							Name:       newUns.GetName(),
-							Namespace:  newUns.GetNamespace(),
-						},
-					}, opts.ResyncInterval)
-				}
-			},
-			// https://github.com/kubernetes/client-go/issues/606
-			// https://github.com/kubernetes/sample-controller/issues/50
-			DeleteFunc: func(obj interface{}) {
-				// el, ok := obj.(*unstructured.Unstructured)
-				// if !ok {
-				// 	opts.Logger.Warn().Msg("DeleteFunc: object is not an unstructured.")
-				// 	return
-				// }
-
-				// id, err := sid.Generate()
-				// if err != nil {
-				// 	opts.Logger.Error().Err(err).Msg("DeleteFunc: generating short id.")
-				// 	return
-				// }
-
-				// queue.Add(event{
-				// 	id:        id,
-				// 	eventType: Delete,
-				// 	objectRef: ObjectRef{
-				// 		APIVersion: el.GetAPIVersion(),
-				// 		Kind:       el.GetKind(),
-				// 		Name:       el.GetName(),
-				// 		Namespace:  el.GetNamespace(),
-				// 	},
-				// })
-			},
-		},
+		c.resyncInterval,
+		c.eventHandler(gvr),
 		cache.Indexers{},
 	)
+}
 
-	return &Controller{
-		dynamicClient:  opts.Client,
-		gvr:            opts.GVR,
-		recorder:       opts.Recorder,
-		logger:         opts.Logger,
-		informer:       informer,
-		indexer:        indexer,
-		queue:          queue,
-		externalClient: opts.ExternalClient,
+// eventHandler returns the handler queueing the informer events of the supplied resource.
+func (c *Controller) eventHandler(gvr schema.GroupVersionResource) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			el, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				c.logger.Warn().Msg("AddFunc: object is not an unstructured.")
+				return
+			}
+
+			ref := objectRef(el, gvr)
+			// A new object with the same name supersedes any pending cleanup.
+			c.tombstones.Delete(ref)
+			c.released.Delete(ref)
+			c.deadLetters.Delete(ref)
+			c.queue.Add(ref)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldUns, ok := old.(*unstructured.Unstructured)
+			if !ok {
+				c.logger.Warn().Msg("UpdateFunc: object is not an unstructured.")
+				return
+			}
+
+			newUns, ok := new.(*unstructured.Unstructured)
+			if !ok {
+				c.logger.Warn().Msg("UpdateFunc: object is not an unstructured.")
+				return
+			}
+
+			ref := objectRef(newUns, gvr)
+
+			// The generation is bumped on every spec change. Any change
+			// missed here is caught up by Observe comparing the spec
+			// with the last applied one.
+			if newUns.GetDeletionTimestamp() != nil || newUns.GetGeneration() != oldUns.GetGeneration() {
+				// A new spec deserves a fresh set of retries.
+				c.deadLetters.Delete(ref)
+				c.queue.Add(ref)
+				return
+			}
+
+			// Dead-lettered objects stay in the slow lane.
+			if c.isDeadLetter(ref) {
+				return
+			}
+
+			c.queue.AddAfter(ref, c.pollInterval(newUns, gvr))
+		},
+		// https://github.com/kubernetes/client-go/issues/606
+		// https://github.com/kubernetes/sample-controller/issues/50
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			el, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				c.logger.Warn().Msg("DeleteFunc: object is not an unstructured.")
+				return
+			}
+
+			// The finalizer may have been removed by someone else,
+			// handleTombstone tells whether anything is left to clean up.
+			ref := objectRef(el, gvr)
+			c.tombstones.Store(ref, el.DeepCopy())
+			c.deadLetters.Delete(ref)
+			c.queue.Add(ref)
+		},
 	}
 }
 
+// SetExternalClient sets the client handling the external resources,
+// along with the optional capabilities it implements. It must be called
+// before Run.
 func (c *Controller) SetExternalClient(ec ExternalClient) {
-	c.externalClient = ec
+	c.externalClient = instrument(ec, c.clientType)
+	c.orphanLister, _ = ec.(OrphanLister)
 }
 
 // Run begins watching and syncing.
 func (c *Controller) Run(ctx context.Context, numWorkers int) error {
 	defer utilruntime.HandleCrash()
-	defer c.queue.ShutDown()
 
 	c.logger.Info().Msg("Starting controller")
-	go c.informer.Run(ctx.Done())
+	c.mu.Lock()
+	c.ctx = ctx
+	synced := make([]cache.InformerSynced, 0, len(c.resources))
+	for gvr, res := range c.resources {
+		c.start(gvr, res)
+		synced = append(synced, res.hasSynced)
+	}
+	c.mu.Unlock()
 
 	// Wait for all involved caches to be synced, before
 	// processing items from the queue is started
 	c.logger.Info().Msg("waiting for informer caches to sync")
-	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
 		err := fmt.Errorf("failed to wait for informers caches to sync")
 		utilruntime.HandleError(err)
 		return err
 	}
+	c.synced.Store(true)
+
+	if c.elected != nil {
+		c.logger.Info().Msg("Waiting for leadership.")
+		select {
+		case <-c.elected:
+		case <-ctx.Done():
+			c.logger.Info().Msg("Stopping controller.")
+			c.queue.ShutDown()
+			return nil
+		}
+	}
 
 	c.logger.Info().Int("workers", numWorkers).Msg("Starting workers.")
+	c.lastDequeue.Store(time.Now().UnixNano())
+	c.running.Store(true)
+
+	// Workers outlive ctx by the shutdown grace period,
+	// so that in-flight reconciles are not interrupted halfway.
+	workerCtx, cancelWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWorkers()
+
+	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
-		go wait.Until(func() {
-			c.runWorker(ctx)
-		}, 2*time.Second, ctx.Done())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runWorker(workerCtx)
+		}()
+	}
+
+	if c.orphanLister != nil && c.sweepInterval > 0 {
+		c.logger.Info().Dur("interval", c.sweepInterval).Msg("Starting orphan sweep.")
+		go wait.UntilWithContext(ctx, c.sweepOrphans, c.sweepInterval)
 	}
 	c.logger.Info().Msg("Controller ready.")
 
 	<-ctx.Done()
-	c.logger.Info().Msg("Stopping controller.")
+	c.logger.Info().Dur("gracePeriod", c.gracePeriod).Msg("Stopping controller, draining in-flight reconciles.")
+	c.shutdown(&wg, cancelWorkers)
+	c.logger.Info().Msg("Controller stopped.")
 
 	return nil
 }
+
+// shutdown stops the workers from picking up queued items and waits for the
+// in-flight reconciles to complete, cancelling them once the grace period
+// expires. Abandoned items are picked up again on the next start, when the
+// informers list all the objects.
+func (c *Controller) shutdown(wg *sync.WaitGroup, cancelWorkers context.CancelFunc) {
+	c.stopping.Store(true)
+
+	drained := make(chan struct{})
+	go func() {
+		c.queue.ShutDownWithDrain()
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(c.gracePeriod):
+		inflight := c.inflight.Load()
+		c.logger.Warn().Int64("items", inflight).Msg("Grace period expired, cancelling in-flight reconciles.")
+		metrics.AddAbandoned(metrics.AbandonedInFlight, int(inflight))
+		cancelWorkers()
+
+		// Cancelled reconciles still need to return before their writes stop.
+		select {
+		case <-drained:
+		case <-time.After(cancelTimeout):
+			c.logger.Warn().Int64("items", c.inflight.Load()).Msg("In-flight reconciles ignored cancellation.")
+		}
+	}
+
+	if n := c.abandoned.Load(); n > 0 {
+		c.logger.Info().Int64("items", n).Msg("Queued items abandoned at shutdown.")
+	}
+}
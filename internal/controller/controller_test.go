@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var testGVR = schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "dummies"}
+
+// fakeClient is an ExternalClient recording the calls it receives.
+type fakeClient struct {
+	mu     sync.Mutex
+	calls  []EventType
+	obs    ExternalObservation
+	err    error
+	block  chan struct{}
+	called chan struct{}
+}
+
+func (f *fakeClient) call(ctx context.Context, typ EventType) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, typ)
+	f.mu.Unlock()
+
+	if f.called != nil {
+		f.called <- struct{}{}
+	}
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return f.err
+}
+
+func (f *fakeClient) Observe(ctx context.Context, _ *unstructured.Unstructured) (ExternalObservation, error) {
+	return f.obs, f.call(ctx, Observe)
+}
+
+func (f *fakeClient) Create(ctx context.Context, _ *unstructured.Unstructured) error {
+	return f.call(ctx, Create)
+}
+
+func (f *fakeClient) Update(ctx context.Context, _ *unstructured.Unstructured) error {
+	return f.call(ctx, Update)
+}
+
+func (f *fakeClient) Delete(ctx context.Context, _ *unstructured.Unstructured) error {
+	return f.call(ctx, Delete)
+}
+
+func (f *fakeClient) Calls() []EventType {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]EventType(nil), f.calls...)
+}
+
+func newObject(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "composition.krateo.io/v1",
+		"kind":       "Dummy",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "default",
+			"generation":      int64(1),
+			"resourceVersion": "1",
+			"finalizers":      []interface{}{finalizerName},
+		},
+		"spec": map[string]interface{}{"replicas": int64(1)},
+	}}
+}
+
+// applied records the spec of the supplied object as applied.
+func applied(t *testing.T, el *unstructured.Unstructured) *unstructured.Unstructured {
+	t.Helper()
+
+	hash, err := specHash(el)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unstructured.SetNestedField(el.Object, el.GetGeneration(), "status", "observedGeneration")
+	_ = unstructured.SetNestedField(el.Object, hash, "status", "lastAppliedSpecHash")
+	return el
+}
+
+// newTestController returns a controller whose API server holds the supplied
+// objects and whose informer cache holds the cached ones.
+func newTestController(t *testing.T, ec ExternalClient, objs []*unstructured.Unstructured, cached ...*unstructured.Unstructured) *Controller {
+	t.Helper()
+
+	all := make([]runtime.Object, 0, len(objs))
+	for _, el := range objs {
+		all = append(all, el.DeepCopy())
+	}
+
+	log := zerolog.Nop()
+	c := New(shortid.MustNew(1, shortid.DefaultABC, 2342), Options{
+		Client: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{testGVR: "DummyList", secretsGVR: "SecretList"}, all...),
+		GVR:            testGVR,
+		ResyncInterval: time.Hour,
+		Logger:         &log,
+		ExternalClient: ec,
+	})
+	t.Cleanup(c.queue.ShutDown)
+
+	indexer, _ := c.indexer(testGVR, "default")
+	for _, el := range cached {
+		if err := indexer.Add(el.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
@@ -2,11 +2,14 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+// EventType is the action taken on the external resource by a reconcile.
 type EventType string
 
 const (
@@ -21,30 +24,49 @@ type ObjectRef struct {
 	Kind       string `json:"kind"`
 	Name       string `json:"name"`
 	Namespace  string `json:"namespace"`
+	// Resource is the plural resource name, used to route the object
+	// to the right resource client when watching several resources.
+	Resource string `json:"resource,omitempty"`
 }
 
 func (o *ObjectRef) String() string {
 	return fmt.Sprintf("%s.%s as %s@%s", o.APIVersion, o.Kind, o.Name, o.Namespace)
 }
 
-type event struct {
-	id        string
-	eventType EventType
-	objectRef ObjectRef
+// GroupVersionResource returns the GroupVersionResource of the referenced object.
+func (o *ObjectRef) GroupVersionResource() schema.GroupVersionResource {
+	gv, _ := schema.ParseGroupVersion(o.APIVersion)
+	return gv.WithResource(o.Resource)
 }
 
+// ErrNotApplied is returned by Create and Update when nothing has been applied
+// to the external resource, e.g. because the outcome of a previous request is
+// still unknown. The spec is not recorded as applied and the request is made
+// again on a later observe.
+var ErrNotApplied = errors.New("spec not applied to the external resource")
+
 // An ExternalClient manages the lifecycle of an external resource.
 // None of the calls here should be blocking. All of the calls should be
 // idempotent. For example, Create call should not return AlreadyExists error
 // if it's called again with the same parameters or Delete call should not
 // return error if there is an ongoing deletion or resource does not exist.
 type ExternalClient interface {
-	Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error)
+	Observe(ctx context.Context, mg *unstructured.Unstructured) (ExternalObservation, error)
 	Create(ctx context.Context, mg *unstructured.Unstructured) error
 	Update(ctx context.Context, mg *unstructured.Unstructured) error
 	Delete(ctx context.Context, mg *unstructured.Unstructured) error
 }
 
+// An OrphanLister is an ExternalClient able to list the external resources
+// it manages, so that the ones left behind by managed resources that vanished
+// unnoticed can be cleaned up.
+type OrphanLister interface {
+	// ListExternal returns the last known state of the managed resources of
+	// the supplied resource type owning an external resource in namespace.
+	// An empty namespace stands for all namespaces.
+	ListExternal(ctx context.Context, gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error)
+}
+
 // An ExternalObservation is the result of an observation of an external resource.
 type ExternalObservation struct {
 	// ResourceExists must be true if a corresponding external resource exists
@@ -55,4 +77,20 @@ type ExternalObservation struct {
 	// appears to be up-to-date - i.e. updating the external resource to match
 	// the desired state of the managed resource would be a no-op.
 	ResourceUpToDate bool
+
+	// ConnectionDetails are the details needed to connect to the external
+	// resource, e.g. endpoints and credentials.
+	ConnectionDetails ConnectionDetails
+
+	// Diff is a human readable summary of the differences between the
+	// external resource and the desired state, if not up-to-date.
+	Diff string
+
+	// PollInterval is the interval the definition of the managed resource
+	// asks its external resource to be observed with, as a duration string,
+	// or empty if the definition does not set any.
+	PollInterval string
 }
+
+// ConnectionDetails are the details needed to connect to an external resource.
+type ConnectionDetails map[string][]byte
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// record emits an Event on the referenced object. The object is read from
+// the informer cache since the copies handed to the external client are
+// stripped of the UID the Event must refer to.
+func (c *Controller) record(ref ObjectRef, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.recorder == nil {
+		return
+	}
+
+	el, ok := c.cached(ref)
+	if !ok {
+		return
+	}
+
+	c.recorder.Eventf(el, eventType, reason, messageFmt, args...)
+}
+
+func (c *Controller) recordNormal(ref ObjectRef, reason, messageFmt string, args ...interface{}) {
+	c.record(ref, corev1.EventTypeNormal, reason, messageFmt, args...)
+}
+
+func (c *Controller) recordWarning(ref ObjectRef, reason, messageFmt string, args ...interface{}) {
+	c.record(ref, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	finalizerName = "composition.krateo.io/finalizer"
+)
+
+// ensureFinalizer adds the controller finalizer to the referenced object,
+// preserving any finalizer owned by other controllers.
+func (c *Controller) ensureFinalizer(ctx context.Context, ref ObjectRef) error {
+	if el, ok := c.cached(ref); ok {
+		if meta.WasDeleted(el) || meta.FinalizerExists(el, finalizerName) {
+			return nil
+		}
+	}
+
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+	if meta.WasDeleted(el) || meta.FinalizerExists(el, finalizerName) {
+		return nil
+	}
+
+	meta.AddFinalizer(el, finalizerName)
+	return c.patchFinalizers(ctx, ref, el)
+}
+
+// removeFinalizer removes only the controller finalizer from the referenced
+// object, preserving any finalizer owned by other controllers.
+func (c *Controller) removeFinalizer(ctx context.Context, ref ObjectRef) error {
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !meta.FinalizerExists(el, finalizerName) {
+		return nil
+	}
+
+	meta.RemoveFinalizer(el, finalizerName)
+	if err := c.patchFinalizers(ctx, ref, el); err != nil {
+		return err
+	}
+
+	// Tells handleTombstone that the external resource has been taken care of.
+	c.released.Store(ref, struct{}{})
+	return nil
+}
+
+// patchFinalizers merge patches the finalizers of the supplied object.
+// Since the whole list is replaced, the patch is guarded by the resourceVersion
+// the list has been computed from.
+func (c *Controller) patchFinalizers(ctx context.Context, ref ObjectRef, el *unstructured.Unstructured) error {
+	dat, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      el.GetFinalizers(),
+			"resourceVersion": el.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.dynamicClient.Resource(ref.GroupVersionResource()).
+		Namespace(el.GetNamespace()).
+		Patch(ctx, el.GetName(), types.MergePatchType, dat, metav1.PatchOptions{
+			FieldManager: tools.FieldManager,
+		})
+	return err
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEnsureFinalizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		finalizers []string
+		deleted    bool
+		want       []string
+	}{
+		{
+			name: "added",
+			want: []string{finalizerName},
+		},
+		{
+			name:       "others preserved",
+			finalizers: []string{"other.io/finalizer"},
+			want:       []string{"other.io/finalizer", finalizerName},
+		},
+		{
+			name:       "already there",
+			finalizers: []string{finalizerName},
+			want:       []string{finalizerName},
+		},
+		{
+			name:       "deleting",
+			finalizers: []string{"other.io/finalizer"},
+			deleted:    true,
+			want:       []string{"other.io/finalizer"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := newObject("demo")
+			el.SetFinalizers(tc.finalizers)
+			if tc.deleted {
+				el.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+			}
+			ref := objectRef(el, testGVR)
+			c := newTestController(t, &fakeClient{}, []*unstructured.Unstructured{el})
+
+			assert.Nil(t, c.ensureFinalizer(context.TODO(), ref))
+
+			live, err := c.fetch(context.TODO(), ref, false)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, live.GetFinalizers())
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// specHash returns a digest of the spec of the supplied object.
+// Map keys are sorted by the JSON encoder so the digest is stable.
+func specHash(el *unstructured.Unstructured) (string, error) {
+	spec, _, err := unstructured.NestedFieldNoCopy(el.Object, "spec")
+	if err != nil {
+		return "", err
+	}
+
+	dat, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// upToDate returns true if the current generation and spec of the supplied
+// object are the ones last applied to the external resource.
+func upToDate(el *unstructured.Unstructured) bool {
+	gen, ok, err := unstructured.NestedInt64(el.Object, "status", "observedGeneration")
+	if err != nil || !ok || gen != el.GetGeneration() {
+		return false
+	}
+
+	last, ok, err := unstructured.NestedString(el.Object, "status", "lastAppliedSpecHash")
+	if err != nil || !ok {
+		return false
+	}
+
+	hash, err := specHash(el)
+	return err == nil && hash == last
+}
+
+// recordApplied stores the generation and the spec hash of the object that has
+// just been applied to the external resource. Nothing is recorded if the spec
+// changed in the meantime, leaving the newer spec to the next reconciliation.
+func (c *Controller) recordApplied(ctx context.Context, ref ObjectRef, applied *unstructured.Unstructured) error {
+	hash, err := specHash(applied)
+	if err != nil {
+		return err
+	}
+
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+
+	if cur, err := specHash(el); err != nil || cur != hash {
+		return err
+	}
+
+	if err := unstructured.SetNestedField(el.Object, el.GetGeneration(), "status", "observedGeneration"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(el.Object, hash, "status", "lastAppliedSpecHash"); err != nil {
+		return err
+	}
+	if err := c.updateStatus(ctx, ref, el); err != nil {
+		return err
+	}
+
+	c.checkPruned(ctx, ref, hash)
+	return nil
+}
+
+// checkPruned reads back the spec hash just recorded. A status schema not
+// declaring the fields prunes them, so that every observe sees a spec never
+// applied and updates the external resource again.
+func (c *Controller) checkPruned(ctx context.Context, ref ObjectRef, hash string) {
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return
+	}
+
+	if last, _, _ := unstructured.NestedString(el.Object, "status", "lastAppliedSpecHash"); last == hash {
+		return
+	}
+
+	c.logger.Warn().Str("ref", ref.String()).
+		Msg("Status fields observedGeneration and lastAppliedSpecHash pruned, the external resource is updated on every observe.")
+	c.recordWarning(ref, condition.ReasonStatusPruned,
+		"Status fields observedGeneration and lastAppliedSpecHash are pruned: declare them in the status schema")
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSpecHash(t *testing.T) {
+	a := newObject("demo")
+	_ = unstructured.SetNestedField(a.Object, map[string]interface{}{"b": "1", "a": "2"}, "spec", "values")
+
+	b := newObject("other")
+	_ = unstructured.SetNestedField(b.Object, map[string]interface{}{"a": "2", "b": "1"}, "spec", "values")
+	b.SetGeneration(7)
+
+	c := a.DeepCopy()
+	_ = unstructured.SetNestedField(c.Object, "3", "spec", "values", "a")
+
+	ha, err := specHash(a)
+	assert.Nil(t, err)
+	hb, err := specHash(b)
+	assert.Nil(t, err)
+	hc, err := specHash(c)
+	assert.Nil(t, err)
+
+	assert.Equal(t, ha, hb, "only the spec matters, whatever the key order")
+	assert.NotEqual(t, ha, hc)
+}
+
+func TestUpToDate(t *testing.T) {
+	tests := []struct {
+		name string
+		el   func() *unstructured.Unstructured
+		want bool
+	}{
+		{
+			name: "never applied",
+			el:   func() *unstructured.Unstructured { return newObject("demo") },
+		},
+		{
+			name: "applied",
+			el:   func() *unstructured.Unstructured { return applied(t, newObject("demo")) },
+			want: true,
+		},
+		{
+			name: "generation bumped",
+			el: func() *unstructured.Unstructured {
+				el := applied(t, newObject("demo"))
+				el.SetGeneration(2)
+				return el
+			},
+		},
+		{
+			name: "spec changed",
+			el: func() *unstructured.Unstructured {
+				el := applied(t, newObject("demo"))
+				_ = unstructured.SetNestedField(el.Object, int64(2), "spec", "replicas")
+				return el
+			},
+		},
+		{
+			name: "hash missing",
+			el: func() *unstructured.Unstructured {
+				el := applied(t, newObject("demo"))
+				unstructured.RemoveNestedField(el.Object, "status", "lastAppliedSpecHash")
+				return el
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, upToDate(tc.el()))
+		})
+	}
+}
+
+func TestRecordApplied(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed bool
+		pruned  bool
+		want    bool
+		events  int
+	}{
+		{name: "recorded", want: true},
+		{name: "spec changed meanwhile", changed: true},
+		{name: "pruned by the schema", pruned: true, events: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := newObject("demo")
+			ref := objectRef(el, testGVR)
+
+			rec := record.NewFakeRecorder(1)
+			c := newTestController(t, &fakeClient{}, []*unstructured.Unstructured{el}, el)
+			c.recorder = rec
+
+			if tc.pruned {
+				cli := c.dynamicClient.(*dynamicfake.FakeDynamicClient)
+				cli.PrependReactor("patch", testGVR.Resource, func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "status" {
+						return false, nil, nil
+					}
+					obj, err := cli.Tracker().Get(testGVR, el.GetNamespace(), el.GetName())
+					return true, obj, err
+				})
+			}
+
+			applied := el.DeepCopy()
+			if tc.changed {
+				_ = unstructured.SetNestedField(applied.Object, int64(2), "spec", "replicas")
+			}
+			assert.Nil(t, c.recordApplied(context.TODO(), ref, applied))
+
+			live, err := c.fetch(context.TODO(), ref, false)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, upToDate(live))
+			assert.Len(t, rec.Events, tc.events)
+		})
+	}
+}
+
+func TestNotAppliedIsNotRecorded(t *testing.T) {
+	el := newObject("demo")
+	ref := objectRef(el, testGVR)
+
+	ec := &fakeClient{obs: ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, err: ErrNotApplied}
+	c := newTestController(t, ec, []*unstructured.Unstructured{el}, el)
+
+	assert.Nil(t, c.handleUpdateEvent(context.TODO(), ref))
+
+	live, err := c.fetch(context.TODO(), ref, false)
+	assert.Nil(t, err)
+	assert.False(t, upToDate(live))
+}
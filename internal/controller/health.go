@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ready returns an error until the informer caches have been synced.
+func (c *Controller) Ready() error {
+	if !c.synced.Load() {
+		return fmt.Errorf("informer caches not synced")
+	}
+	return nil
+}
+
+// Healthy returns an error when the workers are running, the queue is not
+// empty and nothing has been dequeued for longer than the stall timeout.
+func (c *Controller) Healthy() error {
+	if c.stallTimeout <= 0 || !c.running.Load() {
+		return nil
+	}
+
+	if c.queue.Len() == 0 {
+		return nil
+	}
+
+	last := time.Unix(0, c.lastDequeue.Load())
+	if since := time.Since(last); since > c.stallTimeout {
+		return fmt.Errorf("workers stalled: nothing dequeued for %s with %d items queued",
+			since.Round(time.Second), c.queue.Len())
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/metrics"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ ExternalClient = (*instrumentedClient)(nil)
+
+// instrumentedClient wraps an ExternalClient counting the errors
+// returned by each handler.
+type instrumentedClient struct {
+	ExternalClient
+	clientType client.ClientType
+}
+
+func instrument(ec ExternalClient, ct client.ClientType) ExternalClient {
+	if ec == nil {
+		return nil
+	}
+	return &instrumentedClient{ExternalClient: ec, clientType: ct}
+}
+
+func (ic *instrumentedClient) Observe(ctx context.Context, mg *unstructured.Unstructured) (ExternalObservation, error) {
+	obs, err := ic.ExternalClient.Observe(ctx, mg)
+	ic.count(Observe, err)
+	return obs, err
+}
+
+func (ic *instrumentedClient) Create(ctx context.Context, mg *unstructured.Unstructured) error {
+	err := ic.ExternalClient.Create(ctx, mg)
+	ic.count(Create, err)
+	return err
+}
+
+func (ic *instrumentedClient) Update(ctx context.Context, mg *unstructured.Unstructured) error {
+	err := ic.ExternalClient.Update(ctx, mg)
+	ic.count(Update, err)
+	return err
+}
+
+func (ic *instrumentedClient) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
+	err := ic.ExternalClient.Delete(ctx, mg)
+	ic.count(Delete, err)
+	return err
+}
+
+func (ic *instrumentedClient) count(handler EventType, err error) {
+	if err != nil && !errors.Is(err, ErrNotApplied) {
+		metrics.IncHandlerErrors(string(handler), ic.clientType.String())
+	}
+}
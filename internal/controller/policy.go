@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cached returns the last known state of the referenced object from the informer cache.
+func (c *Controller) cached(ref ObjectRef) (*unstructured.Unstructured, bool) {
+	indexer, ok := c.indexer(ref.GroupVersionResource(), ref.Namespace)
+	if !ok {
+		return nil, false
+	}
+
+	obj, exists, err := indexer.GetByKey(cache.NewObjectName(ref.Namespace, ref.Name).String())
+	if err != nil || !exists {
+		return nil, false
+	}
+
+	el, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	return el, true
+}
+
+// handlePaused records that reconciliation of the referenced object is paused.
+// The Event and the condition are only emitted once, when the pause starts.
+func (c *Controller) handlePaused(ctx context.Context, ref ObjectRef) error {
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+
+	if hasCondition(el, condition.TypeSynced, condition.ReasonReconcilePaused) {
+		return nil
+	}
+
+	cond := condition.ReconcilePaused()
+	c.recordNormal(ref, cond.Reason, "%s", cond.Message)
+
+	if err := setCondition(el, cond); err != nil {
+		return err
+	}
+	return c.updateStatus(ctx, ref, el)
+}
+
+// clearSynced removes a stale Synced condition once the object is neither
+// paused nor restricted by a management policy anymore.
+func (c *Controller) clearSynced(ctx context.Context, ref ObjectRef) error {
+	el, ok := c.cached(ref)
+	if !ok || meta.GetManagementPolicy(el) != meta.ManagementPolicyDefault {
+		return nil
+	}
+
+	if !hasCondition(el, condition.TypeSynced, condition.ReasonReconcilePaused) &&
+		!hasCondition(el, condition.TypeSynced, condition.ReasonActionNotAllowed) {
+		return nil
+	}
+
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return err
+	}
+
+	if err := removeCondition(el, condition.TypeSynced); err != nil {
+		return err
+	}
+	return c.updateStatus(ctx, ref, el)
+}
+
+// handleActionNotAllowed records that the supplied action has been suppressed
+// by the management policy of the object. Since the controller will never be
+// allowed to delete the external resource, a suppressed Delete releases the
+// finalizer so that the object can be removed from the cluster.
+func (c *Controller) handleActionNotAllowed(ctx context.Context, ref ObjectRef, el *unstructured.Unstructured, action string) error {
+	msg := fmt.Sprintf("Action '%s' not allowed by management policy '%s'", action, meta.GetManagementPolicy(el))
+
+	c.logger.Info().
+		Str("action", action).
+		Str("name", el.GetName()).
+		Str("namespace", el.GetNamespace()).
+		Msg("Action suppressed by management policy.")
+
+	c.recordNormal(ref, condition.ReasonActionNotAllowed, "%s", msg)
+
+	if action == meta.ActionDelete {
+		return c.removeFinalizer(ctx, ref)
+	}
+
+	if hasCondition(el, condition.TypeSynced, condition.ReasonActionNotAllowed) {
+		return nil
+	}
+
+	if err := setCondition(el, condition.ActionNotAllowed(msg)); err != nil {
+		return err
+	}
+	return c.updateStatus(ctx, ref, el)
+}
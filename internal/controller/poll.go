@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// pollIntervalKey identifies the definitions, which are looked up in the
+// namespace of the objects they define.
+type pollIntervalKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+// pollInterval returns the interval the external resource of the supplied
+// object is observed with: the object annotation, otherwise the interval of
+// its definition, otherwise the resync interval.
+func (c *Controller) pollInterval(el *unstructured.Unstructured, gvr schema.GroupVersionResource) time.Duration {
+	definition, _ := c.pollIntervals.Load(pollIntervalKey{gvr: gvr, namespace: el.GetNamespace()})
+	str, _ := definition.(string)
+	return meta.GetPollInterval(el, str, c.resyncInterval)
+}
+
+// refreshPollInterval stores the interval set on the definition of the
+// referenced object, as reported by the last observation, so that it is
+// available to the informer handlers.
+func (c *Controller) refreshPollInterval(ref ObjectRef, obs ExternalObservation) {
+	c.pollIntervals.Store(pollIntervalKey{gvr: ref.GroupVersionResource(), namespace: ref.Namespace}, obs.PollInterval)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		definition string
+		namespace  string
+		want       time.Duration
+	}{
+		{
+			name: "resync interval",
+			want: time.Hour,
+		},
+		{
+			name:       "definition",
+			definition: "5m",
+			want:       5 * time.Minute,
+		},
+		{
+			name:       "annotation wins",
+			annotation: "30s",
+			definition: "5m",
+			want:       30 * time.Second,
+		},
+		{
+			name:       "invalid annotation",
+			annotation: "soon",
+			definition: "5m",
+			want:       5 * time.Minute,
+		},
+		{
+			name:       "definition of another namespace",
+			definition: "5m",
+			namespace:  "other",
+			want:       time.Hour,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := applied(t, newObject("demo"))
+			if tc.annotation != "" {
+				meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyPollInterval: tc.annotation})
+			}
+
+			// The definition lives in the namespace of the observed object.
+			observed := el.DeepCopy()
+			if tc.namespace != "" {
+				observed.SetNamespace(tc.namespace)
+			}
+
+			ec := &fakeClient{obs: ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+				PollInterval:     tc.definition,
+			}}
+			c := newTestController(t, ec, []*unstructured.Unstructured{observed})
+
+			action, err := c.handleObserve(context.TODO(), objectRef(observed, testGVR))
+			assert.Nil(t, err)
+			assert.Equal(t, Observe, action)
+
+			assert.Equal(t, tc.want, c.pollInterval(el, testGVR))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resource holds the informers watching a single GroupVersionResource,
+// one for each watched namespace.
+type resource struct {
+	informers map[string]*informer
+	cancel    context.CancelFunc
+}
+
+type informer struct {
+	indexer    cache.Indexer
+	controller cache.Controller
+}
+
+// hasSynced returns true once the caches of all the informers are synced.
+func (res *resource) hasSynced() bool {
+	for _, inf := range res.informers {
+		if !inf.controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// AddResource starts watching the supplied resource. If the controller
+// is already running the informers are started immediately, otherwise they
+// are started by Run. Adding an already watched resource is a no-op.
+func (c *Controller) AddResource(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.resources[gvr]; ok {
+		return
+	}
+
+	res := &resource{informers: make(map[string]*informer, len(c.namespaces))}
+	for _, ns := range c.namespaces {
+		inf := &informer{}
+		inf.indexer, inf.controller = c.newInformer(gvr, ns)
+		res.informers[ns] = inf
+	}
+	c.resources[gvr] = res
+
+	if c.ctx != nil {
+		c.start(gvr, res)
+	}
+}
+
+// RemoveResource stops watching the supplied resource.
+func (c *Controller) RemoveResource(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.resources[gvr]
+	if !ok {
+		return
+	}
+
+	if res.cancel != nil {
+		res.cancel()
+	}
+	delete(c.resources, gvr)
+
+	c.logger.Info().Str("gvr", gvr.String()).Msg("Stopped informer.")
+}
+
+// start runs the informers of the supplied resource; must be called with the lock held.
+func (c *Controller) start(gvr schema.GroupVersionResource, res *resource) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	res.cancel = cancel
+
+	for ns, inf := range res.informers {
+		c.logger.Info().Str("gvr", gvr.String()).Str("namespace", ns).Msg("Starting informer.")
+		go inf.controller.Run(ctx.Done())
+	}
+}
+
+// indexer returns the cache of the supplied resource holding the objects of namespace.
+func (c *Controller) indexer(gvr schema.GroupVersionResource, namespace string) (cache.Indexer, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res, ok := c.resources[gvr]
+	if !ok {
+		return nil, false
+	}
+
+	inf, ok := res.informers[namespace]
+	if !ok {
+		inf, ok = res.informers[metav1.NamespaceAll]
+	}
+	if !ok {
+		return nil, false
+	}
+	return inf.indexer, true
+}
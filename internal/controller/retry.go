@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+)
+
+const (
+	defaultMaxRetries         = 5
+	defaultMinBackoff         = 3 * time.Second
+	defaultMaxBackoff         = 180 * time.Second
+	defaultDeadLetterInterval = 10 * time.Minute
+)
+
+// RetryPolicy tells how failed reconciles are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a reconcile is retried with
+	// exponential backoff before being moved to the dead letter lane.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// DeadLetterInterval is the period objects that exhausted their
+	// retries are re-attempted with.
+	DeadLetterInterval time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries <= 0 {
+		p.MaxRetries = defaultMaxRetries
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = defaultMinBackoff
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = defaultMaxBackoff
+		if p.MaxBackoff < p.MinBackoff {
+			p.MaxBackoff = p.MinBackoff
+		}
+	}
+	if p.DeadLetterInterval <= 0 {
+		p.DeadLetterInterval = defaultDeadLetterInterval
+	}
+	return p
+}
+
+// isDeadLetter returns true if the object already exhausted its retries.
+func (c *Controller) isDeadLetter(ref ObjectRef) bool {
+	_, ok := c.deadLetters.Load(ref)
+	return ok
+}
+
+// deadLetterWait returns how long the object has still to wait in the slow
+// lane, zero if it is not dead-lettered or its next attempt is due.
+// Polls and resyncs must not bring dead-lettered objects back any sooner.
+func (c *Controller) deadLetterWait(ref ObjectRef) time.Duration {
+	due, ok := c.deadLetters.Load(ref)
+	if !ok {
+		return 0
+	}
+
+	wait := time.Until(due.(time.Time))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// deadLetter moves the object to the slow lane, recording the last error in a
+// terminal ReconcileError condition.
+// Objects that are gone are dropped, along with their pending cleanup.
+func (c *Controller) deadLetter(ctx context.Context, ref ObjectRef, err error) {
+	c.queue.Forget(ref)
+
+	_, ok := c.cached(ref)
+	if !ok {
+		// Vanished objects have no status to report the error on,
+		// retrying their cleanup forever would go unnoticed.
+		c.dropTombstone(ref, err)
+		return
+	}
+
+	c.deadLetters.Store(ref, time.Now().Add(c.retry.DeadLetterInterval))
+	c.queue.AddAfter(ref, c.retry.DeadLetterInterval)
+
+	cond := condition.ReconcileError(err.Error())
+
+	// The cached copy may predate the status written by the reconcile.
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil {
+		return
+	}
+
+	if co, ok := findCondition(el, condition.TypeSynced); ok &&
+		co.Reason == cond.Reason && co.Message == cond.Message {
+		return
+	}
+
+	if err := setCondition(el, cond); err != nil {
+		return
+	}
+	if err := c.updateStatus(ctx, ref, el); err != nil {
+		c.logger.Warn().Err(err).Str("ref", ref.String()).Msg("Setting reconcile error condition.")
+	}
+}
+
+// recovered drops the object from the slow lane and clears
+// the ReconcileError condition once it is processed successfully.
+func (c *Controller) recovered(ctx context.Context, ref ObjectRef) {
+	c.deadLetters.Delete(ref)
+
+	el, ok := c.cached(ref)
+	if !ok || !hasCondition(el, condition.TypeSynced, condition.ReasonReconcileError) {
+		return
+	}
+
+	// The cached copy may predate the status written by the reconcile.
+	el, err := c.fetch(ctx, ref, false)
+	if err != nil || !hasCondition(el, condition.TypeSynced, condition.ReasonReconcileError) {
+		return
+	}
+
+	if err := removeCondition(el, condition.TypeSynced); err != nil {
+		return
+	}
+	if err := c.updateStatus(ctx, ref, el); err != nil {
+		c.logger.Warn().Err(err).Str("ref", ref.String()).Msg("Clearing reconcile error condition.")
+	}
+}
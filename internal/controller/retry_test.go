@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   RetryPolicy
+		want RetryPolicy
+	}{
+		{
+			name: "zero",
+			want: RetryPolicy{MaxRetries: 5, MinBackoff: 3 * time.Second, MaxBackoff: 180 * time.Second, DeadLetterInterval: 10 * time.Minute},
+		},
+		{
+			name: "custom",
+			in:   RetryPolicy{MaxRetries: 2, MinBackoff: time.Second, MaxBackoff: time.Minute, DeadLetterInterval: time.Hour},
+			want: RetryPolicy{MaxRetries: 2, MinBackoff: time.Second, MaxBackoff: time.Minute, DeadLetterInterval: time.Hour},
+		},
+		{
+			name: "min backoff above the default max",
+			in:   RetryPolicy{MinBackoff: time.Hour},
+			want: RetryPolicy{MaxRetries: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour, DeadLetterInterval: 10 * time.Minute},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.in.withDefaults())
+		})
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	el := applied(t, newObject("demo"))
+	ref := objectRef(el, testGVR)
+
+	tests := []struct {
+		name   string
+		due    time.Duration
+		err    error
+		calls  int
+		dead   bool
+		reason string
+	}{
+		{name: "not due", due: time.Minute, calls: 0, dead: true},
+		{name: "due and failing", due: -time.Second, err: errors.New("boom"), calls: 1, dead: true, reason: condition.ReasonReconcileError},
+		{name: "due and recovering", due: -time.Second, calls: 1, dead: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ec := &fakeClient{obs: ExternalObservation{ResourceExists: true, ResourceUpToDate: true}, err: tc.err}
+			c := newTestController(t, ec, []*unstructured.Unstructured{el}, el)
+
+			c.deadLetters.Store(ref, time.Now().Add(tc.due))
+			c.queue.Add(ref)
+			assert.True(t, c.processNextItem(context.TODO()))
+
+			assert.Len(t, ec.Calls(), tc.calls)
+			assert.Equal(t, tc.dead, c.isDeadLetter(ref))
+			assert.Equal(t, 0, c.queue.Len(), "nothing requeued right away")
+
+			live, err := c.fetch(context.TODO(), ref, false)
+			assert.Nil(t, err)
+			co, ok := findCondition(live, condition.TypeSynced)
+			assert.Equal(t, tc.reason != "", ok)
+			assert.Equal(t, tc.reason, co.Reason)
+		})
+	}
+}
+
+func TestUpdateFuncKeepsDeadLettersInSlowLane(t *testing.T) {
+	el := newObject("demo")
+	ref := objectRef(el, testGVR)
+	c := newTestController(t, &fakeClient{}, nil)
+	c.resyncInterval = 0
+
+	c.deadLetters.Store(ref, time.Now().Add(time.Hour))
+	c.eventHandler(testGVR).OnUpdate(el, el.DeepCopy())
+	assert.Equal(t, 0, c.queue.Len())
+
+	c.deadLetters.Delete(ref)
+	c.eventHandler(testGVR).OnUpdate(el, el.DeepCopy())
+	assert.Eventually(t, func() bool { return c.queue.Len() == 1 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		release   time.Duration
+		cancelled bool
+	}{
+		{name: "drained within the grace period", release: 10 * time.Millisecond},
+		{name: "cancelled once the grace period expires", release: time.Hour, cancelled: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := applied(t, newObject("demo"))
+			queued := applied(t, newObject("queued"))
+
+			ec := &fakeClient{
+				obs:    ExternalObservation{ResourceExists: true, ResourceUpToDate: true},
+				block:  make(chan struct{}),
+				called: make(chan struct{}, 2),
+			}
+			c := newTestController(t, ec, []*unstructured.Unstructured{el, queued}, el, queued)
+			c.gracePeriod = 100 * time.Millisecond
+
+			workerCtx, cancelWorkers := context.WithCancel(context.Background())
+			defer cancelWorkers()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.runWorker(workerCtx)
+			}()
+
+			c.queue.Add(objectRef(el, testGVR))
+			<-ec.called
+			c.queue.Add(objectRef(queued, testGVR))
+
+			timer := time.AfterFunc(tc.release, func() { close(ec.block) })
+			defer timer.Stop()
+
+			c.shutdown(&wg, cancelWorkers)
+
+			assert.Equal(t, int64(0), c.inflight.Load(), "no reconcile left running")
+			assert.Equal(t, tc.cancelled, workerCtx.Err() != nil)
+			assert.Equal(t, int64(1), c.abandoned.Load())
+			assert.Len(t, ec.Calls(), 1)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// getConditions returns the conditions found in the status of the supplied object.
+func getConditions(el *unstructured.Unstructured) []metav1.Condition {
+	items, ok, err := unstructured.NestedSlice(el.Object, "status", "conditions")
+	if err != nil || !ok {
+		return []metav1.Condition{}
+	}
+
+	dat, err := json.Marshal(items)
+	if err != nil {
+		return []metav1.Condition{}
+	}
+
+	conds := []metav1.Condition{}
+	if err := json.Unmarshal(dat, &conds); err != nil {
+		return []metav1.Condition{}
+	}
+	return conds
+}
+
+func setConditions(el *unstructured.Unstructured, conds []metav1.Condition) error {
+	dat, err := json.Marshal(conds)
+	if err != nil {
+		return err
+	}
+
+	var res []interface{}
+	if err := json.Unmarshal(dat, &res); err != nil {
+		return err
+	}
+
+	return unstructured.SetNestedSlice(el.Object, res, "status", "conditions")
+}
+
+func setCondition(el *unstructured.Unstructured, co metav1.Condition) error {
+	conds := getConditions(el)
+	condition.Upsert(&conds, co)
+	return setConditions(el, conds)
+}
+
+func removeCondition(el *unstructured.Unstructured, typ string) error {
+	conds := getConditions(el)
+	condition.Remove(&conds, typ)
+	return setConditions(el, conds)
+}
+
+// findCondition returns the condition with the supplied type, if any.
+func findCondition(el *unstructured.Unstructured, typ string) (metav1.Condition, bool) {
+	for _, co := range getConditions(el) {
+		if co.Type == typ {
+			return co, true
+		}
+	}
+	return metav1.Condition{}, false
+}
+
+// hasCondition returns true if a condition with the supplied type and reason is set.
+func hasCondition(el *unstructured.Unstructured, typ, reason string) bool {
+	for _, co := range getConditions(el) {
+		if co.Type == typ && co.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) updateStatus(ctx context.Context, ref ObjectRef, el *unstructured.Unstructured) error {
+	return tools.PatchResourceStatus(ctx,
+		c.dynamicClient.Resource(ref.GroupVersionResource()).Namespace(el.GetNamespace()), el)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// syncedResources returns the resources whose informer cache is synced.
+func (c *Controller) syncedResources() []schema.GroupVersionResource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	all := make([]schema.GroupVersionResource, 0, len(c.resources))
+	for gvr, res := range c.resources {
+		if res.hasSynced() {
+			all = append(all, gvr)
+		}
+	}
+	return all
+}
+
+// sweepOrphans looks for external resources whose managed resource is gone
+// without the controller noticing, e.g. because the finalizer was removed
+// while the controller was down, and queues their cleanup.
+func (c *Controller) sweepOrphans(ctx context.Context) {
+	for _, gvr := range c.syncedResources() {
+		for _, ns := range c.namespaces {
+			c.sweepNamespace(ctx, gvr, ns)
+		}
+	}
+}
+
+// sweepNamespace queues the cleanup of the orphaned external resources of
+// the supplied resource type in namespace. Resources outside the watched
+// selection are not cached either, handleTombstone makes sure they are
+// really gone before cleaning them up.
+func (c *Controller) sweepNamespace(ctx context.Context, gvr schema.GroupVersionResource, namespace string) {
+	all, err := c.orphanLister.ListExternal(ctx, gvr, namespace)
+	if err != nil {
+		c.logger.Warn().Err(err).Str("resource", gvr.String()).Str("namespace", namespace).Msg("Listing external resources.")
+		return
+	}
+
+	for _, el := range all {
+		// The version recorded by the external resource may well be no
+		// longer served: look the object up with the swept one.
+		el.SetAPIVersion(gvr.GroupVersion().String())
+		ref := objectRef(el, gvr)
+		if _, ok := c.cached(ref); ok {
+			continue
+		}
+		if meta.GetDeletionPolicy(el, "") == meta.DeletionPolicyOrphan {
+			continue
+		}
+		if _, loaded := c.tombstones.LoadOrStore(ref, el); loaded {
+			continue
+		}
+
+		c.logger.Info().Str("ref", ref.String()).Msg("Found orphaned external resource.")
+		c.queue.Add(ref)
+	}
+}
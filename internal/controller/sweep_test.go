@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// orphanClient is a fakeClient listing the supplied external resources.
+type orphanClient struct {
+	fakeClient
+	external []*unstructured.Unstructured
+}
+
+func (o *orphanClient) ListExternal(context.Context, schema.GroupVersionResource, string) ([]*unstructured.Unstructured, error) {
+	all := make([]*unstructured.Unstructured, 0, len(o.external))
+	for _, el := range o.external {
+		all = append(all, el.DeepCopy())
+	}
+	return all, nil
+}
+
+func TestSweepNamespace(t *testing.T) {
+	// Recorded by an external resource installed with a previous version.
+	recorded := func(name string) *unstructured.Unstructured {
+		el := newObject(name)
+		el.SetAPIVersion("composition.krateo.io/v0")
+		return el
+	}
+
+	tests := []struct {
+		name    string
+		cached  []*unstructured.Unstructured
+		queued  int
+		pending bool
+	}{
+		{
+			name:   "still there",
+			cached: []*unstructured.Unstructured{newObject("demo")},
+		},
+		{
+			name:    "gone",
+			queued:  1,
+			pending: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ec := &orphanClient{external: []*unstructured.Unstructured{recorded("demo")}}
+			c := newTestController(t, ec, nil, tc.cached...)
+
+			c.sweepNamespace(context.TODO(), testGVR, "default")
+
+			assert.Equal(t, tc.queued, c.queue.Len())
+			obj, pending := c.tombstones.Load(objectRef(newObject("demo"), testGVR))
+			assert.Equal(t, tc.pending, pending)
+			if pending {
+				assert.Equal(t, "composition.krateo.io/v1", obj.(*unstructured.Unstructured).GetAPIVersion())
+			}
+		})
+	}
+}
+
+func TestSetExternalClientOrphanLister(t *testing.T) {
+	c := newTestController(t, &fakeClient{}, nil)
+	assert.Nil(t, c.orphanLister)
+
+	ec := &orphanClient{}
+	c.SetExternalClient(ec)
+	assert.Equal(t, ec, c.orphanLister)
+
+	c.SetExternalClient(&fakeClient{})
+	assert.Nil(t, c.orphanLister)
+}
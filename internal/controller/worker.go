@@ -2,76 +2,159 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"time"
 
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/metrics"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/runtime"
 )
 
-const (
-	maxRetries = 5
-)
-
 func (c *Controller) runWorker(ctx context.Context) {
-	for {
-		obj, shutdown := c.queue.Get()
-		if shutdown {
-			break
-		}
-		defer c.queue.Done(obj)
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	c.lastDequeue.Store(time.Now().UnixNano())
+	defer c.queue.Done(obj)
 
-		err := c.processItem(ctx, obj)
-		c.handleErr(err, obj)
+	// Shutting down: only the reconciles already in flight are drained.
+	if c.stopping.Load() {
+		c.abandoned.Add(1)
+		metrics.AddAbandoned(metrics.AbandonedQueued, 1)
+		return true
 	}
+
+	// Dead-lettered objects are only retried when due.
+	if ref, ok := obj.(ObjectRef); ok {
+		if wait := c.deadLetterWait(ref); wait > 0 {
+			c.queue.AddAfter(ref, wait)
+			return true
+		}
+	}
+
+	c.inflight.Add(1)
+	defer c.inflight.Add(-1)
+
+	err := c.processItem(ctx, obj)
+	c.handleErr(ctx, err, obj)
+	return true
 }
 
-func (c *Controller) handleErr(err error, obj interface{}) {
+func (c *Controller) handleErr(ctx context.Context, err error, obj interface{}) {
+	ref, ok := obj.(ObjectRef)
+	if !ok {
+		c.queue.Forget(obj)
+		return
+	}
+
 	if err == nil {
 		c.queue.Forget(obj)
+		c.recovered(ctx, ref)
+		// Observe again after the poll interval, which may well be
+		// shorter than the informer resync interval.
+		if el, ok := c.cached(ref); ok && !meta.WasDeleted(el) {
+			c.queue.AddAfter(ref, c.pollInterval(el, ref.GroupVersionResource()))
+		}
+		return
+	}
+
+	if c.isDeadLetter(ref) {
+		c.logger.Warn().Str("ref", ref.String()).
+			Msgf("error processing object: %v, retrying in %s", err, c.retry.DeadLetterInterval)
+		c.deadLetter(ctx, ref, err)
 		return
 	}
 
-	if retries := c.queue.NumRequeues(obj); retries < maxRetries {
+	if retries := c.queue.NumRequeues(obj); retries < c.retry.MaxRetries {
 		c.logger.Warn().Int("retries", retries).
-			Str("obj", fmt.Sprintf("%v", obj)).
-			Msgf("error processing event: %v, retrying", err)
+			Str("ref", ref.String()).
+			Msgf("error processing object: %v, retrying", err)
 		c.queue.AddRateLimited(obj)
 		return
 	}
 
-	c.logger.Err(err).Msg("error processing event (max retries reached)")
-	c.queue.Forget(obj)
+	c.logger.Err(err).
+		Str("ref", ref.String()).
+		Dur("retryInterval", c.retry.DeadLetterInterval).
+		Msg("error processing object (max retries reached)")
+	c.recordWarning(ref, condition.ReasonRetriesExhausted,
+		"Giving up after %d retries: %s", c.retry.MaxRetries, err.Error())
+	c.deadLetter(ctx, ref, err)
 	runtime.HandleError(err)
 }
 
-func (c *Controller) processItem(ctx context.Context, obj interface{}) error {
-	evt, ok := obj.(event)
+// processItem reconciles the referenced object. The action to take is
+// computed from the current state of the object, so that any number of
+// notifications for the same object collapse into a single reconcile.
+func (c *Controller) processItem(ctx context.Context, obj interface{}) (err error) {
+	ref, ok := obj.(ObjectRef)
 	if !ok {
-		c.logger.Error().Msgf("unexpected event: %v", obj)
+		c.logger.Error().Msgf("unexpected queue item: %v", obj)
+		return nil
+	}
+
+	action := Observe
+	start := time.Now()
+	defer func() {
+		metrics.ObserveReconcile(string(action), start, err)
+	}()
+
+	id, _ := c.sid.Generate()
+	c.logger.Debug().Str("id", id).Str("ref", ref.String()).Msg("processing")
+
+	el, ok := c.cached(ref)
+	if !ok {
+		if obj, ok := c.tombstones.Load(ref); ok {
+			action = Delete
+			return c.handleTombstone(ctx, ref, obj.(*unstructured.Unstructured))
+		}
+		c.logger.Debug().Str("id", id).Str("ref", ref.String()).Msg("Object not found, nothing to do.")
 		return nil
 	}
 
-	c.logger.Debug().Str("event", string(evt.eventType)).Str("ref", evt.objectRef.String()).Msg("processing")
-	switch evt.eventType {
-	case Create:
-		return c.handleCreate(ctx, evt.objectRef)
-	case Update:
-		return c.handleUpdateEvent(ctx, evt.objectRef)
-	case Delete:
-		return c.handleDeleteEvent(ctx, evt.objectRef)
-	default:
-		return c.handleObserve(ctx, evt.objectRef)
+	if meta.IsPaused(el) {
+		c.logger.Debug().Str("ref", ref.String()).Msg("Reconciliation paused.")
+		return c.handlePaused(ctx, ref)
 	}
+
+	if err := c.clearSynced(ctx, ref); err != nil {
+		c.logger.Warn().Err(err).Str("ref", ref.String()).Msg("Clearing synced condition.")
+	}
+
+	if meta.WasDeleted(el) {
+		action = Delete
+		return c.handleDeleteEvent(ctx, ref)
+	}
+
+	if err := c.ensureFinalizer(ctx, ref); err != nil {
+		c.logger.Err(err).Str("ref", ref.String()).Msg("Adding finalizer.")
+		return err
+	}
+
+	action, err = c.handleObserve(ctx, ref)
+	c.logger.Debug().Str("id", id).Str("action", string(action)).Str("ref", ref.String()).Msg("processed")
+	return err
 }
 
-func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
+// handleObserve observes the external resource, creating or updating it as
+// needed. It returns the action that has been taken.
+func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) (EventType, error) {
 	if c.externalClient == nil {
 		c.logger.Warn().
 			Str("eventType", string(Observe)).
 			Msg("No event handler registered.")
-		return nil
+		return Observe, nil
 	}
 
 	el, err := c.fetch(ctx, ref, false)
@@ -79,23 +162,20 @@ func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
 		c.logger.Err(err).
 			Str("objectRef", ref.String()).
 			Msg("Resolving unstructured object.")
-		return err
+		return Observe, err
 	}
 
-	exists, err := c.externalClient.Observe(ctx, el)
+	obs, err := c.externalClient.Observe(ctx, el)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			c.queue.Add(event{
-				eventType: Update,
-				objectRef: ref,
-			})
-			return nil
-		}
-		return err
+		return Observe, err
 	}
+	c.refreshPollInterval(ref, obs)
 
-	if !exists {
-		return c.externalClient.Create(ctx, el)
+	if !obs.ResourceExists {
+		if !meta.IsActionAllowed(el, meta.ActionCreate) {
+			return Create, c.handleActionNotAllowed(ctx, ref, el, meta.ActionCreate)
+		}
+		return Create, c.create(ctx, ref, el)
 		// fmt.Println("Creating object")
 
 		// rateLimiter := workqueue.NewMaxOfRateLimiter(
@@ -123,28 +203,40 @@ func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
 
 	}
 
-	return nil
-}
+	if err := c.publishConnectionDetails(ctx, el, obs.ConnectionDetails); err != nil {
+		return Observe, err
+	}
 
-func (c *Controller) handleCreate(ctx context.Context, ref ObjectRef) error {
-	if c.externalClient == nil {
-		c.logger.Warn().
-			Str("eventType", string(Create)).
-			Msg("No event handler registered.")
-		return nil
+	if !obs.ResourceUpToDate {
+		c.logger.Debug().Str("ref", ref.String()).Str("diff", obs.Diff).Msg("External resource not up-to-date.")
+		c.recordNormal(ref, condition.ReasonDriftDetected, "External resource not up-to-date: %s", obs.Diff)
+		return Update, c.handleUpdateEvent(ctx, ref)
 	}
 
-	// fmt.Println("Creating object - handleCreate")
+	// Catch up with spec changes that were never applied,
+	// e.g. because they happened while the controller was down.
+	if !upToDate(el) {
+		c.logger.Debug().Str("ref", ref.String()).Msg("Spec changed since last applied.")
+		c.recordNormal(ref, condition.ReasonDriftDetected, "Spec changed since it was last applied")
+		return Update, c.handleUpdateEvent(ctx, ref)
+	}
 
-	el, err := c.fetch(ctx, ref, true)
-	if err != nil {
-		c.logger.Err(err).
-			Str("objectRef", ref.String()).
-			Msg("Resolving unstructured object.")
+	return Observe, nil
+}
+
+func (c *Controller) create(ctx context.Context, ref ObjectRef, el *unstructured.Unstructured) error {
+	c.recordNormal(ref, condition.ReasonCreating, "Creating external resource")
+
+	if err := c.externalClient.Create(ctx, el); errors.Is(err, ErrNotApplied) {
+		c.logger.Debug().Str("ref", ref.String()).Msg("External resource creation not applied.")
+		return nil
+	} else if err != nil {
+		c.recordWarning(ref, condition.ReasonCreateFailed, "Cannot create external resource: %s", err.Error())
 		return err
 	}
 
-	return c.externalClient.Create(ctx, el)
+	c.recordNormal(ref, condition.ReasonCreated, "Successfully requested creation of external resource")
+	return c.recordApplied(ctx, ref, el)
 }
 
 func (c *Controller) handleUpdateEvent(ctx context.Context, ref ObjectRef) error {
@@ -163,7 +255,22 @@ func (c *Controller) handleUpdateEvent(ctx context.Context, ref ObjectRef) error
 		return err
 	}
 
-	return c.externalClient.Update(ctx, el)
+	if !meta.IsActionAllowed(el, meta.ActionUpdate) {
+		return c.handleActionNotAllowed(ctx, ref, el, meta.ActionUpdate)
+	}
+
+	c.recordNormal(ref, condition.ReasonUpdating, "Updating external resource")
+
+	if err := c.externalClient.Update(ctx, el); errors.Is(err, ErrNotApplied) {
+		c.logger.Debug().Str("ref", ref.String()).Msg("External resource update not applied.")
+		return nil
+	} else if err != nil {
+		c.recordWarning(ref, condition.ReasonUpdateFailed, "Cannot update external resource: %s", err.Error())
+		return err
+	}
+
+	c.recordNormal(ref, condition.ReasonUpdated, "Successfully requested update of external resource")
+	return c.recordApplied(ctx, ref, el)
 }
 
 func (c *Controller) handleDeleteEvent(ctx context.Context, ref ObjectRef) error {
@@ -176,17 +283,104 @@ func (c *Controller) handleDeleteEvent(ctx context.Context, ref ObjectRef) error
 
 	el, err := c.fetch(ctx, ref, true)
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
 		c.logger.Err(err).
 			Str("objectRef", ref.String()).
 			Msg("Resolving unstructured object.")
 		return err
 	}
 
-	return c.externalClient.Delete(ctx, el)
+	// Nothing left to clean up once the controller finalizer is gone.
+	if !meta.FinalizerExists(el, finalizerName) {
+		return nil
+	}
+
+	if !meta.IsActionAllowed(el, meta.ActionDelete) {
+		return c.handleActionNotAllowed(ctx, ref, el, meta.ActionDelete)
+	}
+
+	c.recordNormal(ref, condition.ReasonDeleting, "Deleting external resource")
+
+	err = c.externalClient.Delete(ctx, el)
+	if err != nil {
+		c.recordWarning(ref, condition.ReasonDeleteFailed, "Cannot delete external resource: %s", err.Error())
+		return err
+	}
+
+	c.recordNormal(ref, condition.ReasonDeleted, "Successfully deleted external resource")
+	return c.removeFinalizer(ctx, ref)
+}
+
+// handleTombstone cleans up the external resource of an object that is
+// already gone from the API server, using its last known state. Nothing is
+// left to clean up if the controller released the finalizer itself.
+func (c *Controller) handleTombstone(ctx context.Context, ref ObjectRef, el *unstructured.Unstructured) error {
+	if _, ok := c.released.LoadAndDelete(ref); ok {
+		c.tombstones.Delete(ref)
+		return nil
+	}
+
+	if c.externalClient == nil || !meta.IsActionAllowed(el, meta.ActionDelete) {
+		c.tombstones.Delete(ref)
+		return nil
+	}
+
+	// NotFound only proves the object gone for a resource being watched,
+	// a version that is no longer served is NotFound as well.
+	if _, ok := c.indexer(ref.GroupVersionResource(), ref.Namespace); !ok {
+		c.logger.Debug().Str("ref", ref.String()).Msg("Resource not watched anymore, nothing to clean up.")
+		c.tombstones.Delete(ref)
+		return nil
+	}
+
+	// Objects leaving the watched selection, e.g. relabeled to another
+	// shard, look deleted to the informer, and objects deleted meanwhile
+	// may have been recreated with the same name, taking over the external
+	// resource: only clean up what is really gone.
+	live, err := c.fetch(ctx, ref, false)
+	if err == nil {
+		if uid := el.GetUID(); uid != "" && live.GetUID() != uid {
+			c.logger.Debug().Str("ref", ref.String()).Msg("Object recreated, leaving the external resource to it.")
+		} else {
+			c.logger.Debug().Str("ref", ref.String()).Msg("Object left the watched selection, nothing to clean up.")
+		}
+		c.tombstones.Delete(ref)
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	c.logger.Info().Str("ref", ref.String()).Msg("Cleaning up external resource of vanished object.")
+
+	if err := c.externalClient.Delete(ctx, el.DeepCopy()); err != nil {
+		return err
+	}
+
+	c.tombstones.Delete(ref)
+	return nil
+}
+
+// dropTombstone gives up cleaning up the external resource of a vanished
+// object, recording a warning Event on its last known state.
+func (c *Controller) dropTombstone(ref ObjectRef, err error) {
+	obj, ok := c.tombstones.LoadAndDelete(ref)
+	c.deadLetters.Delete(ref)
+	if !ok {
+		return
+	}
+
+	c.logger.Warn().Err(err).Str("ref", ref.String()).Msg("Giving up cleaning up external resource of vanished object.")
+	if c.recorder != nil {
+		c.recorder.Eventf(obj.(*unstructured.Unstructured), corev1.EventTypeWarning, condition.ReasonDeleteFailed,
+			"Cannot clean up external resource of vanished object: %s", err.Error())
+	}
 }
 
 func (c *Controller) fetch(ctx context.Context, ref ObjectRef, clean bool) (*unstructured.Unstructured, error) {
-	res, err := c.dynamicClient.Resource(c.gvr).
+	res, err := c.dynamicClient.Resource(ref.GroupVersionResource()).
 		Namespace(ref.Namespace).
 		Get(ctx, ref.Name, metav1.GetOptions{})
 	if err == nil {
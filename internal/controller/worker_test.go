@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestQueueDedup(t *testing.T) {
+	el := applied(t, newObject("demo"))
+	ec := &fakeClient{obs: ExternalObservation{ResourceExists: true, ResourceUpToDate: true}}
+	c := newTestController(t, ec, []*unstructured.Unstructured{el}, el)
+
+	changed := el.DeepCopy()
+	changed.SetGeneration(2)
+
+	h := c.eventHandler(testGVR)
+	h.OnAdd(el, false)
+	h.OnUpdate(el, changed)
+	h.OnUpdate(changed, changed)
+	assert.Equal(t, 1, c.queue.Len())
+
+	assert.True(t, c.processNextItem(context.TODO()))
+	assert.Equal(t, 0, c.queue.Len())
+	assert.Equal(t, []EventType{Observe}, ec.Calls())
+}
+
+func TestProcessItem(t *testing.T) {
+	tests := []struct {
+		name  string
+		el    func(t *testing.T) *unstructured.Unstructured
+		obs   ExternalObservation
+		calls []EventType
+	}{
+		{
+			name:  "up-to-date",
+			el:    func(t *testing.T) *unstructured.Unstructured { return applied(t, newObject("demo")) },
+			obs:   ExternalObservation{ResourceExists: true, ResourceUpToDate: true},
+			calls: []EventType{Observe},
+		},
+		{
+			name:  "missing",
+			el:    func(t *testing.T) *unstructured.Unstructured { return newObject("demo") },
+			calls: []EventType{Observe, Create},
+		},
+		{
+			name:  "drifted",
+			el:    func(t *testing.T) *unstructured.Unstructured { return applied(t, newObject("demo")) },
+			obs:   ExternalObservation{ResourceExists: true},
+			calls: []EventType{Observe, Update},
+		},
+		{
+			name:  "spec never applied",
+			el:    func(t *testing.T) *unstructured.Unstructured { return newObject("demo") },
+			obs:   ExternalObservation{ResourceExists: true, ResourceUpToDate: true},
+			calls: []EventType{Observe, Update},
+		},
+		{
+			name: "create not allowed",
+			el: func(t *testing.T) *unstructured.Unstructured {
+				el := newObject("demo")
+				meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyManagementPolicy: meta.ManagementPolicyObserve})
+				return el
+			},
+			calls: []EventType{Observe},
+		},
+		{
+			name: "deleting",
+			el: func(t *testing.T) *unstructured.Unstructured {
+				el := newObject("demo")
+				el.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+				return el
+			},
+			calls: []EventType{Delete},
+		},
+		{
+			name: "paused",
+			el: func(t *testing.T) *unstructured.Unstructured {
+				el := newObject("demo")
+				meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyReconciliationPaused: "true"})
+				return el
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := tc.el(t)
+			ec := &fakeClient{obs: tc.obs}
+			c := newTestController(t, ec, []*unstructured.Unstructured{el}, el)
+
+			assert.Nil(t, c.processItem(context.TODO(), objectRef(el, testGVR)))
+			assert.Equal(t, tc.calls, ec.Calls())
+		})
+	}
+}
+
+func TestHandleTombstone(t *testing.T) {
+	tests := []struct {
+		name     string
+		el       func() *unstructured.Unstructured
+		exists   bool
+		liveUID  string
+		released bool
+		err      error
+		calls    []EventType
+		pending  bool
+	}{
+		{
+			name:  "finalizer removed by someone else",
+			el:    func() *unstructured.Unstructured { return newObject("demo") },
+			calls: []EventType{Delete},
+		},
+		{
+			name: "never finalized",
+			el: func() *unstructured.Unstructured {
+				el := newObject("demo")
+				el.SetFinalizers(nil)
+				return el
+			},
+			calls: []EventType{Delete},
+		},
+		{
+			name:     "released by the controller",
+			el:       func() *unstructured.Unstructured { return newObject("demo") },
+			released: true,
+		},
+		{
+			name:   "left the watched selection",
+			el:     func() *unstructured.Unstructured { return newObject("demo") },
+			exists: true,
+		},
+		{
+			name: "recreated",
+			el: func() *unstructured.Unstructured {
+				el := newObject("demo")
+				el.SetUID("old")
+				return el
+			},
+			exists:  true,
+			liveUID: "new",
+		},
+		{
+			name: "version not watched",
+			el: func() *unstructured.Unstructured {
+				el := newObject("demo")
+				el.SetAPIVersion("composition.krateo.io/v0")
+				return el
+			},
+		},
+		{
+			name: "delete not allowed",
+			el: func() *unstructured.Unstructured {
+				el := newObject("demo")
+				meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyManagementPolicy: meta.ManagementPolicyObserve})
+				return el
+			},
+		},
+		{
+			name:    "delete failing",
+			el:      func() *unstructured.Unstructured { return newObject("demo") },
+			err:     errors.New("boom"),
+			calls:   []EventType{Delete},
+			pending: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			el := tc.el()
+			ref := objectRef(el, testGVR)
+
+			objs := []*unstructured.Unstructured{}
+			if tc.exists {
+				live := el.DeepCopy()
+				if tc.liveUID != "" {
+					live.SetUID(types.UID(tc.liveUID))
+				}
+				objs = append(objs, live)
+			}
+
+			ec := &fakeClient{err: tc.err}
+			c := newTestController(t, ec, objs)
+			if tc.released {
+				c.released.Store(ref, struct{}{})
+			}
+
+			c.eventHandler(testGVR).OnDelete(el)
+			assert.True(t, c.processNextItem(context.TODO()))
+
+			assert.Equal(t, tc.calls, ec.Calls())
+			_, pending := c.tombstones.Load(ref)
+			assert.Equal(t, tc.pending, pending)
+			_, released := c.released.Load(ref)
+			assert.False(t, released)
+		})
+	}
+}
+
+func TestDeadLetterDropsTombstone(t *testing.T) {
+	el := newObject("demo")
+	ref := objectRef(el, testGVR)
+
+	rec := record.NewFakeRecorder(1)
+	c := newTestController(t, &fakeClient{}, nil)
+	c.recorder = rec
+	c.tombstones.Store(ref, el)
+
+	c.deadLetter(context.TODO(), ref, errors.New("no definition found"))
+
+	_, pending := c.tombstones.Load(ref)
+	assert.False(t, pending)
+	assert.False(t, c.isDeadLetter(ref))
+	assert.Equal(t, 0, c.queue.Len())
+	assert.Equal(t, "Warning DeleteFailed Cannot clean up external resource of vanished object: no definition found", <-rec.Events)
+}
+
+func TestRemoveFinalizerReleases(t *testing.T) {
+	el := newObject("demo")
+	ref := objectRef(el, testGVR)
+	c := newTestController(t, &fakeClient{}, []*unstructured.Unstructured{el})
+
+	assert.Nil(t, c.removeFinalizer(context.TODO(), ref))
+
+	live, err := c.fetch(context.TODO(), ref, false)
+	assert.Nil(t, err)
+	assert.False(t, meta.FinalizerExists(live, finalizerName))
+	_, released := c.released.Load(ref)
+	assert.True(t, released)
+}
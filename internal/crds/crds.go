@@ -0,0 +1,106 @@
+// Package crds resolves the resources to watch from CustomResourceDefinitions.
+package crds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// GVR is the GroupVersionResource of the CustomResourceDefinitions.
+var GVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// Filter selects the CustomResourceDefinitions whose resources must be watched.
+type Filter struct {
+	// LabelSelector filters the CustomResourceDefinitions by label.
+	LabelSelector string
+	// GroupSuffix, when set, keeps only the CustomResourceDefinitions
+	// whose group ends with the supplied suffix.
+	GroupSuffix string
+}
+
+// Matches returns true if the supplied CustomResourceDefinition group
+// satisfies the filter group suffix.
+func (f Filter) Matches(crd *unstructured.Unstructured) bool {
+	if len(f.GroupSuffix) == 0 {
+		return true
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	return strings.HasSuffix(group, f.GroupSuffix)
+}
+
+// List returns the storage version GroupVersionResource of every
+// CustomResourceDefinition matching the supplied filter.
+func List(ctx context.Context, dyn dynamic.Interface, filter Filter) ([]schema.GroupVersionResource, error) {
+	all, err := dyn.Resource(GVR).List(ctx, metav1.ListOptions{
+		LabelSelector: filter.LabelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]schema.GroupVersionResource, 0, len(all.Items))
+	for i := range all.Items {
+		if !filter.Matches(&all.Items[i]) {
+			continue
+		}
+
+		gvr, err := ToGVR(&all.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, gvr)
+	}
+
+	return res, nil
+}
+
+// ToGVR returns the GroupVersionResource of the storage version
+// of the supplied CustomResourceDefinition.
+func ToGVR(crd *unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	group, _, err := unstructured.NestedString(crd.Object, "spec", "group")
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	plural, _, err := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	for _, el := range versions {
+		ver, ok := el.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if storage, _ := ver["storage"].(bool); !storage {
+			continue
+		}
+
+		name, _ := ver["name"].(string)
+		return schema.GroupVersionResource{
+			Group:    group,
+			Version:  name,
+			Resource: plural,
+		}, nil
+	}
+
+	return schema.GroupVersionResource{},
+		fmt.Errorf("no storage version found for crd: %s", crd.GetName())
+}
@@ -0,0 +1,62 @@
+package crds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestToGVR(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name": "repoes.gen.github.com",
+		},
+		"spec": map[string]interface{}{
+			"group": "gen.github.com",
+			"names": map[string]interface{}{
+				"kind":   "Repo",
+				"plural": "repoes",
+			},
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1alpha1", "served": true, "storage": false},
+				map[string]interface{}{"name": "v1alpha2", "served": true, "storage": true},
+			},
+		},
+	}}
+
+	gvr, err := ToGVR(crd)
+	assert.Nil(t, err)
+	assert.Equal(t, schema.GroupVersionResource{
+		Group:    "gen.github.com",
+		Version:  "v1alpha2",
+		Resource: "repoes",
+	}, gvr)
+
+	unstructured.RemoveNestedField(crd.Object, "spec", "versions")
+	_, err = ToGVR(crd)
+	assert.NotNil(t, err)
+}
+
+func TestFilterMatches(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	_ = unstructured.SetNestedField(crd.Object, "gen.github.com", "spec", "group")
+
+	assert.True(t, Filter{}.Matches(crd))
+	assert.True(t, Filter{GroupSuffix: "github.com"}.Matches(crd))
+	assert.False(t, Filter{GroupSuffix: "krateo.io"}.Matches(crd))
+}
+
+func TestIsEstablished(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	assert.False(t, IsEstablished(crd))
+
+	_ = unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+		map[string]interface{}{"type": "Established", "status": "True"},
+	}, "status", "conditions")
+	assert.True(t, IsEstablished(crd))
+}
@@ -0,0 +1,108 @@
+package crds
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+type WatchOptions struct {
+	Client dynamic.Interface
+	Filter Filter
+	Logger *zerolog.Logger
+	// OnAdd is invoked when an established CustomResourceDefinition
+	// matching the filter appears.
+	OnAdd func(gvr schema.GroupVersionResource)
+	// OnDelete is invoked when a CustomResourceDefinition matching
+	// the filter disappears or changes its storage version.
+	OnDelete func(gvr schema.GroupVersionResource)
+}
+
+// Watch runs an informer over the CustomResourceDefinitions until the
+// context is cancelled, notifying the resources that appear and disappear.
+func Watch(ctx context.Context, opts WatchOptions) {
+	lw := &cache.ListWatch{
+		ListFunc: func(lo metav1.ListOptions) (runtime.Object, error) {
+			lo.LabelSelector = opts.Filter.LabelSelector
+			return opts.Client.Resource(GVR).List(ctx, lo)
+		},
+		WatchFunc: func(lo metav1.ListOptions) (watch.Interface, error) {
+			lo.LabelSelector = opts.Filter.LabelSelector
+			return opts.Client.Resource(GVR).Watch(ctx, lo)
+		},
+	}
+
+	_, informer := cache.NewInformer(lw, &unstructured.Unstructured{}, 0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if gvr, ok := opts.resolve(obj); ok {
+					opts.OnAdd(gvr)
+				}
+			},
+			UpdateFunc: func(old, new interface{}) {
+				oldGVR, oldOk := opts.resolve(old)
+				newGVR, newOk := opts.resolve(new)
+				if oldOk && (!newOk || oldGVR != newGVR) {
+					opts.OnDelete(oldGVR)
+				}
+				if newOk {
+					opts.OnAdd(newGVR)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if gvr, ok := opts.resolve(obj); ok {
+					opts.OnDelete(gvr)
+				}
+			},
+		},
+	)
+
+	opts.Logger.Info().
+		Str("labelSelector", opts.Filter.LabelSelector).
+		Str("groupSuffix", opts.Filter.GroupSuffix).
+		Msg("Watching custom resource definitions.")
+
+	informer.Run(ctx.Done())
+}
+
+// resolve returns the GroupVersionResource of the supplied object if it
+// is an established CustomResourceDefinition matching the filter.
+func (opts WatchOptions) resolve(obj interface{}) (schema.GroupVersionResource, bool) {
+	crd, ok := obj.(*unstructured.Unstructured)
+	if !ok || !opts.Filter.Matches(crd) || !IsEstablished(crd) {
+		return schema.GroupVersionResource{}, false
+	}
+
+	gvr, err := ToGVR(crd)
+	if err != nil {
+		opts.Logger.Warn().Err(err).Str("crd", crd.GetName()).Msg("Resolving resource.")
+		return schema.GroupVersionResource{}, false
+	}
+	return gvr, true
+}
+
+// IsEstablished returns true if the supplied CustomResourceDefinition
+// has the Established condition set to True.
+func IsEstablished(crd *unstructured.Unstructured) bool {
+	conds, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, el := range conds {
+		co, ok := el.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if co["type"] == "Established" && co["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
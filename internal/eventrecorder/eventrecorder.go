@@ -23,5 +23,7 @@ func Create(rc *rest.Config) (record.EventRecorder, error) {
 	eventBroadcaster.StartRecordingToSink(&typedv1core.EventSinkImpl{
 		Interface: clientset.CoreV1().Events(""),
 	})
-	return eventBroadcaster.NewRecorder(scheme, corev1.EventSource{}), nil
+	return eventBroadcaster.NewRecorder(scheme, corev1.EventSource{
+		Component: "composition-dynamic-controller",
+	}), nil
 }
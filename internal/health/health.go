@@ -0,0 +1,28 @@
+// Package health serves the liveness and readiness probes of the controller.
+package health
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Checker reports a non nil error when the probed component is not healthy.
+type Checker func() error
+
+// Handler returns an http.Handler that replies 200 when the supplied
+// checker succeeds and 503 with the error message otherwise.
+func Handler(check Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "%s\n", err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+}
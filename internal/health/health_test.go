@@ -0,0 +1,39 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	cases := map[string]struct {
+		check Checker
+		code  int
+		body  string
+	}{
+		"Healthy": {
+			check: func() error { return nil },
+			code:  http.StatusOK,
+			body:  "ok\n",
+		},
+		"Unhealthy": {
+			check: func() error { return errors.New("caches not synced") },
+			code:  http.StatusServiceUnavailable,
+			body:  "caches not synced\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(tc.check).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+			assert.Equal(t, tc.code, rec.Code)
+			assert.Equal(t, tc.body, rec.Body.String())
+		})
+	}
+}
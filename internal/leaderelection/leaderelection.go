@@ -0,0 +1,101 @@
+// Package leaderelection runs a Lease based leader election so that only
+// one replica of the controller reconciles the managed resources at a time.
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+type Options struct {
+	// Namespace where the Lease object lives.
+	Namespace string
+	// LeaseName is the name of the Lease object.
+	LeaseName string
+	// LeaseDuration is the duration that non-leader candidates will wait
+	// to force acquire leadership.
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration that the acting leader will retry
+	// refreshing leadership before giving up.
+	RenewDeadline time.Duration
+	// RetryPeriod is the duration the clients should wait between
+	// tries of actions.
+	RetryPeriod time.Duration
+	Logger      *zerolog.Logger
+}
+
+// Run starts the leader election in background until the context is cancelled.
+// The elected channel is closed as soon as this replica becomes the leader,
+// the done channel once the election stopped and the lease has been released.
+// The supplied onLost callback is invoked if the leadership is lost while
+// the context is still active.
+func Run(ctx context.Context, cfg *rest.Config, opts Options, onLost func()) (elected, done <-chan struct{}, err error) {
+	id, err := identity()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lock, err := resourcelock.NewFromKubeconfig(resourcelock.LeasesResourceLock,
+		opts.Namespace, opts.LeaseName,
+		resourcelock.ResourceLockConfig{Identity: id},
+		cfg, opts.RenewDeadline)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	electedCh := make(chan struct{})
+
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            opts.LeaseName,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				opts.Logger.Info().Str("identity", id).Msg("Started leading.")
+				close(electedCh)
+			},
+			OnStoppedLeading: func() {
+				opts.Logger.Info().Str("identity", id).Msg("Stopped leading.")
+				if ctx.Err() == nil && onLost != nil {
+					onLost()
+				}
+			},
+			OnNewLeader: func(current string) {
+				if current == id {
+					return
+				}
+				opts.Logger.Info().Str("leader", current).Msg("New leader elected.")
+			},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		le.Run(ctx)
+	}()
+
+	return electedCh, doneCh, nil
+}
+
+func identity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to get hostname: %w", err)
+	}
+	return hostname + "_" + string(uuid.NewUUID()), nil
+}
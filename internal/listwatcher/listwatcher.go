@@ -12,22 +12,34 @@ import (
 )
 
 type CreateOptions struct {
-	Client    dynamic.Interface
-	GVR       schema.GroupVersionResource
+	Client dynamic.Interface
+	GVR    schema.GroupVersionResource
+	// Namespace is the namespace to watch, empty for all namespaces.
 	Namespace string
+	// LabelSelector restricts the watched objects by their labels.
+	LabelSelector string
+	// FieldSelector restricts the watched objects by their fields.
+	FieldSelector string
 }
 
 func Create(opts CreateOptions) *cache.ListWatch {
 	return &cache.ListWatch{
 		ListFunc: func(lo metav1.ListOptions) (runtime.Object, error) {
+			opts.apply(&lo)
 			return opts.Client.Resource(opts.GVR).
 				Namespace(opts.Namespace).
 				List(context.Background(), lo)
 		},
 		WatchFunc: func(lo metav1.ListOptions) (watch.Interface, error) {
+			opts.apply(&lo)
 			return opts.Client.Resource(opts.GVR).
 				Namespace(opts.Namespace).
 				Watch(context.Background(), lo)
 		},
 	}
 }
+
+func (opts CreateOptions) apply(lo *metav1.ListOptions) {
+	lo.LabelSelector = opts.LabelSelector
+	lo.FieldSelector = opts.FieldSelector
+}
@@ -2,6 +2,8 @@
 package meta
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -55,6 +57,32 @@ const (
 	// observe: The provider can only observe the resource.
 	//          This maps to the read-only scenario where the resource is fully controlled by third party application.
 	AnnotationKeyManagementPolicy = "krateo.io/management-policy"
+
+	// AnnotationKeyDeletionPolicy is the key in the annotations map of a
+	// resource that overrides the deletion policy of its definition.
+	// Delete: the external resource is deleted along with the resource.
+	// Orphan: the external resource is left untouched.
+	AnnotationKeyDeletionPolicy = "krateo.io/deletion-policy"
+
+	// AnnotationKeyPollInterval is the key in the annotations map of a
+	// resource that overrides the interval its external resource is
+	// observed with, as a duration string (e.g. 15s, 1h).
+	AnnotationKeyPollInterval = "krateo.io/poll-interval"
+
+	// AnnotationKeyAutoHeal is the key in the annotations map of a
+	// resource that overrides whether the drift of its external resource
+	// from the desired state is healed automatically (true or false).
+	AnnotationKeyAutoHeal = "krateo.io/auto-heal"
+
+	// AnnotationKeyInstallOptions is the key in the annotations map of a
+	// resource that overrides the Helm install options of its definition,
+	// as a JSON object (e.g. {"wait": true, "timeout": "5m"}).
+	AnnotationKeyInstallOptions = "krateo.io/install-options"
+
+	// AnnotationKeyUpgradeOptions is the key in the annotations map of a
+	// resource that overrides the Helm upgrade options of its definition,
+	// as a JSON object (e.g. {"force": true}).
+	AnnotationKeyUpgradeOptions = "krateo.io/upgrade-options"
 )
 
 const (
@@ -69,6 +97,13 @@ const (
 	// ManagementPolicyObserve means the provider can only observe the resource.
 	ManagementPolicyObserve = "observe"
 
+	// DeletionPolicyDelete means the external resource is deleted
+	// when the resource is deleted.
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyOrphan means the external resource is left untouched
+	// when the resource is deleted.
+	DeletionPolicyOrphan = "Orphan"
+
 	// ActionCreate means to create an Object
 	ActionCreate = "create"
 	// ActionUpdate means to update an Object
@@ -279,12 +314,19 @@ func IsVerbose(o metav1.Object) bool {
 	return o.GetAnnotations()[AnnotationKeyConnectorVerbose] == "true"
 }
 
-// IsActionAllowed determines if action is allowed to be performed on Object
-func IsActionAllowed(o metav1.Object, action string) bool {
+// GetManagementPolicy returns the management policy annotation value on the
+// resource, or ManagementPolicyDefault if it is not set.
+func GetManagementPolicy(o metav1.Object) string {
 	p := o.GetAnnotations()[AnnotationKeyManagementPolicy]
 	if len(p) == 0 {
-		p = ManagementPolicyDefault
+		return ManagementPolicyDefault
 	}
+	return p
+}
+
+// IsActionAllowed determines if action is allowed to be performed on Object
+func IsActionAllowed(o metav1.Object, action string) bool {
+	p := GetManagementPolicy(o)
 
 	if action == ActionCreate || action == ActionUpdate {
 		return p == ManagementPolicyDefault || p == ManagementPolicyObserveCreateUpdate
@@ -293,3 +335,41 @@ func IsActionAllowed(o metav1.Object, action string) bool {
 	// ObjectActionDelete
 	return p == ManagementPolicyDefault || p == ManagementPolicyObserveDelete
 }
+
+// GetDeletionPolicy returns the deletion policy of the resource: the
+// annotation value if set, otherwise the supplied definition policy,
+// otherwise DeletionPolicyDelete.
+func GetDeletionPolicy(o metav1.Object, definitionPolicy string) string {
+	for _, p := range []string{o.GetAnnotations()[AnnotationKeyDeletionPolicy], definitionPolicy} {
+		if strings.EqualFold(p, DeletionPolicyOrphan) {
+			return DeletionPolicyOrphan
+		}
+		if strings.EqualFold(p, DeletionPolicyDelete) {
+			return DeletionPolicyDelete
+		}
+	}
+	return DeletionPolicyDelete
+}
+
+// GetPollInterval returns the interval the external resource of the resource
+// is observed with: the annotation value if set, otherwise the supplied
+// definition interval, otherwise defaultInterval. Values that are not
+// positive durations are ignored.
+func GetPollInterval(o metav1.Object, definitionInterval string, defaultInterval time.Duration) time.Duration {
+	for _, v := range []string{o.GetAnnotations()[AnnotationKeyPollInterval], definitionInterval} {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultInterval
+}
+
+// IsAutoHeal returns true if the drift of the external resource of the
+// resource must be healed automatically: the annotation value if set,
+// otherwise the supplied definition setting.
+func IsAutoHeal(o metav1.Object, definitionAutoHeal bool) bool {
+	if v, err := strconv.ParseBool(o.GetAnnotations()[AnnotationKeyAutoHeal]); err == nil {
+		return v
+	}
+	return definitionAutoHeal
+}
@@ -637,6 +637,194 @@ func TestIsPaused(t *testing.T) {
 	}
 }
 
+func TestIsActionAllowed(t *testing.T) {
+	withPolicy := func(p string) metav1.Object {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationKeyManagementPolicy: p}}}
+	}
+
+	cases := map[string]struct {
+		o      metav1.Object
+		action string
+		want   bool
+	}{
+		"NoPolicyCreate": {
+			o:      &corev1.Pod{},
+			action: ActionCreate,
+			want:   true,
+		},
+		"ObserveCreate": {
+			o:      withPolicy(ManagementPolicyObserve),
+			action: ActionCreate,
+			want:   false,
+		},
+		"ObserveDelete": {
+			o:      withPolicy(ManagementPolicyObserve),
+			action: ActionDelete,
+			want:   false,
+		},
+		"ObserveDeleteUpdate": {
+			o:      withPolicy(ManagementPolicyObserveDelete),
+			action: ActionUpdate,
+			want:   false,
+		},
+		"ObserveDeleteDelete": {
+			o:      withPolicy(ManagementPolicyObserveDelete),
+			action: ActionDelete,
+			want:   true,
+		},
+		"ObserveCreateUpdateUpdate": {
+			o:      withPolicy(ManagementPolicyObserveCreateUpdate),
+			action: ActionUpdate,
+			want:   true,
+		},
+		"ObserveCreateUpdateDelete": {
+			o:      withPolicy(ManagementPolicyObserveCreateUpdate),
+			action: ActionDelete,
+			want:   false,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := IsActionAllowed(tc.o, tc.action)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("IsActionAllowed(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetDeletionPolicy(t *testing.T) {
+	withPolicy := func(p string) metav1.Object {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationKeyDeletionPolicy: p}}}
+	}
+
+	cases := map[string]struct {
+		o          metav1.Object
+		definition string
+		want       string
+	}{
+		"NoPolicy": {
+			o:    &corev1.Pod{},
+			want: DeletionPolicyDelete,
+		},
+		"DefinitionOrphan": {
+			o:          &corev1.Pod{},
+			definition: DeletionPolicyOrphan,
+			want:       DeletionPolicyOrphan,
+		},
+		"AnnotationOverridesDefinition": {
+			o:          withPolicy(DeletionPolicyDelete),
+			definition: DeletionPolicyOrphan,
+			want:       DeletionPolicyDelete,
+		},
+		"AnnotationCaseInsensitive": {
+			o:    withPolicy("orphan"),
+			want: DeletionPolicyOrphan,
+		},
+		"InvalidAnnotation": {
+			o:          withPolicy("Keep"),
+			definition: DeletionPolicyOrphan,
+			want:       DeletionPolicyOrphan,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := GetDeletionPolicy(tc.o, tc.definition)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetDeletionPolicy(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetPollInterval(t *testing.T) {
+	withInterval := func(i string) metav1.Object {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationKeyPollInterval: i}}}
+	}
+
+	cases := map[string]struct {
+		o          metav1.Object
+		definition string
+		want       time.Duration
+	}{
+		"NoInterval": {
+			o:    &corev1.Pod{},
+			want: time.Minute,
+		},
+		"DefinitionInterval": {
+			o:          &corev1.Pod{},
+			definition: "1h",
+			want:       time.Hour,
+		},
+		"AnnotationOverridesDefinition": {
+			o:          withInterval("15s"),
+			definition: "1h",
+			want:       15 * time.Second,
+		},
+		"InvalidAnnotation": {
+			o:          withInterval("often"),
+			definition: "1h",
+			want:       time.Hour,
+		},
+		"NegativeInterval": {
+			o:    withInterval("-15s"),
+			want: time.Minute,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := GetPollInterval(tc.o, tc.definition, time.Minute)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetPollInterval(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsAutoHeal(t *testing.T) {
+	withAutoHeal := func(v string) metav1.Object {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationKeyAutoHeal: v}}}
+	}
+
+	cases := map[string]struct {
+		o          metav1.Object
+		definition bool
+		want       bool
+	}{
+		"NoAnnotation": {
+			o:    &corev1.Pod{},
+			want: false,
+		},
+		"DefinitionAutoHeal": {
+			o:          &corev1.Pod{},
+			definition: true,
+			want:       true,
+		},
+		"AnnotationEnables": {
+			o:    withAutoHeal("true"),
+			want: true,
+		},
+		"AnnotationOverridesDefinition": {
+			o:          withAutoHeal("false"),
+			definition: true,
+			want:       false,
+		},
+		"InvalidAnnotation": {
+			o:          withAutoHeal("sometimes"),
+			definition: true,
+			want:       true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := IsAutoHeal(tc.o, tc.definition)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("IsAutoHeal(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
 func EquateErrors() cmp.Option {
 	return cmp.Comparer(func(a, b error) bool {
 		if a == nil || b == nil {
@@ -0,0 +1,187 @@
+// Package metrics exposes the Prometheus metrics of the composition controller.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	namespace = "composition_controller"
+)
+
+var (
+	// Registry is the registry all the controller metrics are registered to.
+	Registry = prometheus.NewRegistry()
+
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Total number of reconciliations per event type and result.",
+	}, []string{"event_type", "result"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken by a reconciliation per event type.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+	}, []string{"event_type"})
+
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_errors_total",
+		Help:      "Total number of errors returned by the external client handlers per handler and client type.",
+	}, []string{"handler", "client_type"})
+
+	abandonedItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shutdown_abandoned_items_total",
+		Help:      "Total number of items abandoned at shutdown, either still queued or cancelled while in flight.",
+	}, []string{"state"})
+)
+
+// States of the items abandoned at shutdown.
+const (
+	AbandonedQueued   = "queued"
+	AbandonedInFlight = "in_flight"
+)
+
+// Handler returns the http handler serving the registered metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveReconcile records the result and the duration of a reconciliation.
+func ObserveReconcile(eventType string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	reconcileTotal.WithLabelValues(eventType, result).Inc()
+	reconcileDuration.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+}
+
+// IncHandlerErrors increments the error count of the supplied handler.
+func IncHandlerErrors(handler, clientType string) {
+	handlerErrors.WithLabelValues(handler, clientType).Inc()
+}
+
+// AddAbandoned adds n to the count of the items abandoned at shutdown in the supplied state.
+func AddAbandoned(state string, n int) {
+	abandonedItems.WithLabelValues(state).Add(float64(n))
+}
+
+var (
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"name"})
+
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Total number of adds handled by the workqueue.",
+	}, []string{"name"})
+
+	queueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "queue_duration_seconds",
+		Help:      "How long in seconds an item stays in the workqueue before being requested.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 12),
+	}, []string{"name"})
+
+	queueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_seconds",
+		Help:      "How long in seconds processing an item from the workqueue takes.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 12),
+	}, []string{"name"})
+
+	queueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "unfinished_work_seconds",
+		Help:      "How many seconds of work has been done that is in progress and hasn't been observed by work_duration.",
+	}, []string{"name"})
+
+	queueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "longest_running_processor_seconds",
+		Help:      "How many seconds has the longest running processor for the workqueue been running.",
+	}, []string{"name"})
+
+	queueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Total number of retries handled by the workqueue.",
+	}, []string{"name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		reconcileTotal,
+		reconcileDuration,
+		handlerErrors,
+		abandonedItems,
+		queueDepth,
+		queueAdds,
+		queueLatency,
+		queueWorkDuration,
+		queueUnfinishedWork,
+		queueLongestRunning,
+		queueRetries,
+	)
+}
+
+var _ workqueue.MetricsProvider = (*queueMetricsProvider)(nil)
+
+// QueueMetricsProvider returns a workqueue.MetricsProvider that registers
+// the workqueue metrics to the Registry.
+func QueueMetricsProvider() workqueue.MetricsProvider {
+	return queueMetricsProvider{}
+}
+
+type queueMetricsProvider struct{}
+
+func (queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return queueDepth.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return queueAdds.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return queueLatency.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return queueWorkDuration.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return queueUnfinishedWork.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return queueLongestRunning.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return queueRetries.WithLabelValues(name)
+}
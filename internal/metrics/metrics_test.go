@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	ObserveReconcile("Observe", time.Now(), nil)
+	ObserveReconcile("Create", time.Now(), errors.New("boom"))
+	IncHandlerErrors("Create", "REST")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, `composition_controller_reconcile_total{event_type="Observe",result="success"} 1`))
+	assert.True(t, strings.Contains(body, `composition_controller_reconcile_total{event_type="Create",result="error"} 1`))
+	assert.True(t, strings.Contains(body, `composition_controller_handler_errors_total{client_type="REST",handler="Create"} 1`))
+}
@@ -3,6 +3,8 @@ package archive
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,11 +15,15 @@ import (
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 )
 
+// ErrDefinitionNotFound is returned when no definition exists for a resource.
+var ErrDefinitionNotFound = errors.New("no definition found")
+
 type Info struct {
 	// URL of the helm chart package that is being requested.
 	URL string `json:"url"`
@@ -30,6 +36,81 @@ type Info struct {
 
 	// RegistryAuth is the credentials to access the registry.
 	RegistryAuth *helmclient.RegistryAuth `json:"registryAuth,omitempty"`
+
+	// DeletionPolicy is the deletion policy of the definition [Delete, Orphan].
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// PollInterval is the interval the compositions are observed with (e.g. 1h).
+	PollInterval string `json:"pollInterval,omitempty"`
+
+	// AutoHeal re-applies the release when the live state of its objects drifts.
+	AutoHeal bool `json:"autoHeal,omitempty"`
+
+	// ConnectionDetails are the release outputs published as connection details.
+	ConnectionDetails []ConnectionDetail `json:"connectionDetails,omitempty"`
+
+	// UpgradeStrategy is how the releases are upgraded.
+	UpgradeStrategy UpgradeStrategy `json:"upgradeStrategy,omitempty"`
+
+	// Install are the Helm options the releases are installed with.
+	Install ReleaseOptions `json:"install,omitempty"`
+
+	// Upgrade are the Helm options the releases are upgraded with.
+	Upgrade ReleaseOptions `json:"upgrade,omitempty"`
+}
+
+// ReleaseOptions are the Helm options a release is installed or upgraded
+// with. Unset fields keep the defaults of the controller; the options that
+// do not apply to the operation are ignored.
+type ReleaseOptions struct {
+	Atomic          *bool `json:"atomic,omitempty"`
+	CleanupOnFail   *bool `json:"cleanupOnFail,omitempty"`
+	CreateNamespace *bool `json:"createNamespace,omitempty"`
+	DisableHooks    *bool `json:"disableHooks,omitempty"`
+	Force           *bool `json:"force,omitempty"`
+	MaxHistory      *int  `json:"maxHistory,omitempty"`
+	Recreate        *bool `json:"recreate,omitempty"`
+	Replace         *bool `json:"replace,omitempty"`
+	ResetValues     *bool `json:"resetValues,omitempty"`
+	ReuseValues     *bool `json:"reuseValues,omitempty"`
+	SkipCRDs        *bool `json:"skipCRDs,omitempty"`
+	SubNotes        *bool `json:"subNotes,omitempty"`
+	UpgradeCRDs     *bool `json:"upgradeCRDs,omitempty"`
+	Wait            *bool `json:"wait,omitempty"`
+	WaitForJobs     *bool `json:"waitForJobs,omitempty"`
+
+	// Timeout of the operation (e.g. 5m), when waiting or atomic.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// UpgradeStrategy is how the releases are upgraded.
+type UpgradeStrategy struct {
+	// RollbackOnFailure rolls a release back to its last deployed revision
+	// when an upgrade fails.
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+
+	// Timeout is how long the upgraded resources are waited for to become
+	// ready (e.g. 5m); an upgrade whose resources are not ready in time fails.
+	// Upgrades do not wait if empty.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ConnectionDetail selects a release output published under the supplied name.
+type ConnectionDetail struct {
+	// Name is the key of the connection detail.
+	Name string `json:"name"`
+
+	// FromSecretKeyRef selects a key of a Secret rendered by the release.
+	FromSecretKeyRef *SecretKeyRef `json:"fromSecretKeyRef,omitempty"`
+
+	// FromNotes selects the rendered release notes.
+	FromNotes bool `json:"fromNotes,omitempty"`
+}
+
+// SecretKeyRef selects a key of a Secret rendered by the release.
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
 }
 
 func (i *Info) IsOCI() bool {
@@ -136,7 +217,7 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 	tot := len(got)
 	if tot == 0 {
 		return nil,
-			fmt.Errorf("no definition found for '%v' in namespace: %s", gvr, uns.GetNamespace())
+			fmt.Errorf("%w for '%v' in namespace: %s", ErrDefinitionNotFound, gvr, uns.GetNamespace())
 	}
 
 	if tot > 1 {
@@ -190,12 +271,54 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 			return nil, err
 		}
 	}
+	deletionPolicy, _, err := unstructured.NestedString(got[0].UnstructuredContent(), "spec", "deletionPolicy")
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.deletionPolicy': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
+	pollInterval, _, err := unstructured.NestedString(got[0].UnstructuredContent(), "spec", "pollInterval")
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.pollInterval': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
 	insecureSkipTLSverify, _, err := unstructured.NestedBool(got[0].UnstructuredContent(), "spec", "chart", "insecureSkipTLSverify")
 	if err != nil {
 		log.Printf("[ERR] resolving 'spec.chart.insecureSkipTLSverify': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
 		return nil, err
 	}
 
+	autoHeal, _, err := unstructured.NestedBool(got[0].UnstructuredContent(), "spec", "autoHeal")
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.autoHeal': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
+	connectionDetails, err := getConnectionDetails(got[0])
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.connectionDetails': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
+	upgradeStrategy, err := getUpgradeStrategy(got[0])
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.upgradeStrategy': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
+	installOptions, err := getReleaseOptions(got[0], "install")
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.install': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
+	upgradeOptions, err := getReleaseOptions(got[0], "upgrade")
+	if err != nil {
+		log.Printf("[ERR] resolving 'spec.upgrade': %s (%s@%s)\n", err.Error(), got[0].GetName(), got[0].GetNamespace())
+		return nil, err
+	}
+
 	return &Info{
 		URL:     packageUrl,
 		Version: packageVersion,
@@ -205,9 +328,58 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 			Password:              password,
 			InsecureSkipTLSverify: insecureSkipTLSverify,
 		},
+		DeletionPolicy:    deletionPolicy,
+		PollInterval:      pollInterval,
+		AutoHeal:          autoHeal,
+		ConnectionDetails: connectionDetails,
+		UpgradeStrategy:   upgradeStrategy,
+		Install:           installOptions,
+		Upgrade:           upgradeOptions,
 	}, nil
 }
 
+func getConnectionDetails(def *unstructured.Unstructured) ([]ConnectionDetail, error) {
+	items, ok, err := unstructured.NestedSlice(def.UnstructuredContent(), "spec", "connectionDetails")
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	dat, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ConnectionDetail
+	if err := json.Unmarshal(dat, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func getUpgradeStrategy(def *unstructured.Unstructured) (UpgradeStrategy, error) {
+	res := UpgradeStrategy{}
+
+	obj, ok, err := unstructured.NestedMap(def.UnstructuredContent(), "spec", "upgradeStrategy")
+	if err != nil || !ok {
+		return res, err
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &res)
+	return res, err
+}
+
+func getReleaseOptions(def *unstructured.Unstructured, field string) (ReleaseOptions, error) {
+	res := ReleaseOptions{}
+
+	obj, ok, err := unstructured.NestedMap(def.UnstructuredContent(), "spec", field)
+	if err != nil || !ok {
+		return res, err
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &res)
+	return res, err
+}
+
 type SecretKeySelector struct {
 	Name      string
 	Namespace string
@@ -0,0 +1,105 @@
+package helmchart
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// CompareRelease returns a human readable description of what differs between
+// the installed release and the desired state of the supplied resource: the
+// chart version, if one is requested, and the values taken from the spec.
+// It returns an empty string if the release is up-to-date.
+func CompareRelease(rel *release.Release, mg *unstructured.Unstructured, version string) (string, error) {
+	if rel == nil {
+		return "", nil
+	}
+
+	if version != "" && rel.Chart != nil && rel.Chart.Metadata != nil {
+		installed := rel.Chart.Metadata.Version
+		if strings.TrimPrefix(installed, "v") != strings.TrimPrefix(version, "v") {
+			return fmt.Sprintf("chart version %s differs from the installed %s", version, installed), nil
+		}
+	}
+
+	dat, err := ExtractValuesFromSpec(mg)
+	if err != nil {
+		return "", err
+	}
+
+	desired := map[string]interface{}{}
+	if len(dat) > 0 {
+		if err := sigsyaml.Unmarshal(dat, &desired); err != nil {
+			return "", err
+		}
+	}
+
+	// The release config holds the user supplied values only,
+	// as returned by GetReleaseValues without all values.
+	installed, err := normalizeValues(rel.Config)
+	if err != nil {
+		return "", err
+	}
+
+	if paths := diffValues(desired, installed, ""); len(paths) > 0 {
+		return "values differ from the installed release: " + strings.Join(paths, ", "), nil
+	}
+	return "", nil
+}
+
+// diffValues returns the sorted dot separated paths of the values that are
+// set, removed or changed in desired with respect to installed.
+func diffValues(desired, installed map[string]interface{}, prefix string) []string {
+	res := []string{}
+	for k, v := range desired {
+		cur, ok := installed[k]
+		if !ok {
+			res = append(res, prefix+k)
+			continue
+		}
+
+		dm, ok1 := v.(map[string]interface{})
+		im, ok2 := cur.(map[string]interface{})
+		if ok1 && ok2 {
+			res = append(res, diffValues(dm, im, prefix+k+".")...)
+			continue
+		}
+
+		if !reflect.DeepEqual(v, cur) {
+			res = append(res, prefix+k)
+		}
+	}
+
+	for k := range installed {
+		if _, ok := desired[k]; !ok {
+			res = append(res, prefix+k)
+		}
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+// normalizeValues round trips the supplied values through JSON, so that
+// they can be compared regardless of the types they were decoded with.
+func normalizeValues(values map[string]interface{}) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	if len(values) == 0 {
+		return res, nil
+	}
+
+	dat, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dat, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+package helmchart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCompareRelease(t *testing.T) {
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"app":      map[string]interface{}{"service": map[string]interface{}{"port": int64(31180)}},
+		},
+	}}
+
+	rel := &release.Release{
+		Name:  "demo",
+		Chart: &chart.Chart{Metadata: &chart.Metadata{Version: "0.1.0"}},
+		Config: map[string]interface{}{
+			"replicas": 2,
+			"app":      map[string]interface{}{"service": map[string]interface{}{"port": float64(31180)}},
+		},
+	}
+
+	diff, err := CompareRelease(rel, mg, "0.1.0")
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	diff, err = CompareRelease(rel, mg, "")
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	diff, err = CompareRelease(rel, mg, "0.2.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "chart version 0.2.0 differs from the installed 0.1.0", diff)
+
+	_ = unstructured.SetNestedField(mg.Object, int64(3), "spec", "replicas")
+	diff, err = CompareRelease(rel, mg, "0.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "values differ from the installed release: replicas", diff)
+
+	_ = unstructured.SetNestedField(mg.Object, int64(8080), "spec", "app", "service", "port")
+	_ = unstructured.SetNestedField(mg.Object, "demo", "spec", "name")
+	diff, err = CompareRelease(rel, mg, "0.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "values differ from the installed release: app.service.port, name, replicas", diff)
+}
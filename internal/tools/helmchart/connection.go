@@ -0,0 +1,72 @@
+package helmchart
+
+import (
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	corev1 "k8s.io/api/core/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// ConnectionDetails extracts the selected outputs of the supplied release.
+// Only the Secrets rendered by the release itself are looked up, so that a
+// composition cannot be used to read arbitrary Secrets of the cluster.
+func ConnectionDetails(rel *release.Release, details []archive.ConnectionDetail) (map[string][]byte, error) {
+	if rel == nil || len(details) == 0 {
+		return nil, nil
+	}
+
+	secrets, err := renderedSecrets(rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string][]byte{}
+	for _, cd := range details {
+		if cd.Name == "" {
+			continue
+		}
+
+		switch {
+		case cd.FromNotes:
+			if rel.Info != nil && rel.Info.Notes != "" {
+				res[cd.Name] = []byte(rel.Info.Notes)
+			}
+		case cd.FromSecretKeyRef != nil:
+			sec, ok := secrets[cd.FromSecretKeyRef.Name]
+			if !ok {
+				continue
+			}
+			if val, ok := sec.StringData[cd.FromSecretKeyRef.Key]; ok {
+				res[cd.Name] = []byte(val)
+			} else if val, ok := sec.Data[cd.FromSecretKeyRef.Key]; ok {
+				res[cd.Name] = val
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// renderedSecrets returns the Secrets found in the supplied manifest by name.
+func renderedSecrets(manifest string) (map[string]corev1.Secret, error) {
+	res := map[string]corev1.Secret{}
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var head releaseutil.SimpleHead
+		if err := sigsyaml.Unmarshal([]byte(doc), &head); err != nil {
+			return nil, fmt.Errorf("parsing release manifest: %w", err)
+		}
+		if head.Version != "v1" || head.Kind != "Secret" || head.Metadata == nil {
+			continue
+		}
+
+		var sec corev1.Secret
+		if err := sigsyaml.Unmarshal([]byte(doc), &sec); err != nil {
+			return nil, fmt.Errorf("parsing secret '%s' of release manifest: %w", head.Metadata.Name, err)
+		}
+		res[sec.Name] = sec
+	}
+	return res, nil
+}
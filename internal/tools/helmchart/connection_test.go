@@ -0,0 +1,52 @@
+package helmchart
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const connectionManifest = `---
+# Source: demo/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: demo
+---
+# Source: demo/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo-credentials
+data:
+  password: czNjcjN0
+stringData:
+  username: admin
+`
+
+func TestConnectionDetails(t *testing.T) {
+	rel := &release.Release{
+		Name:     "demo",
+		Manifest: connectionManifest,
+		Info:     &release.Info{Notes: "Visit http://demo.example.com"},
+	}
+
+	got, err := ConnectionDetails(rel, []archive.ConnectionDetail{
+		{Name: "username", FromSecretKeyRef: &archive.SecretKeyRef{Name: "demo-credentials", Key: "username"}},
+		{Name: "password", FromSecretKeyRef: &archive.SecretKeyRef{Name: "demo-credentials", Key: "password"}},
+		{Name: "notes", FromNotes: true},
+		{Name: "missing", FromSecretKeyRef: &archive.SecretKeyRef{Name: "other", Key: "password"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"username": []byte("admin"),
+		"password": []byte("s3cr3t"),
+		"notes":    []byte("Visit http://demo.example.com"),
+	}, got)
+
+	got, err = ConnectionDetails(rel, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
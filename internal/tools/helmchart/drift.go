@@ -0,0 +1,251 @@
+package helmchart
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// Drift is a field of a rendered object whose live value differs.
+type Drift struct {
+	Ref  controller.ObjectRef
+	Path string
+}
+
+func (d Drift) String() string {
+	if d.Ref.Namespace == "" {
+		return fmt.Sprintf("%s %s: %s", d.Ref.Kind, d.Ref.Name, d.Path)
+	}
+	return fmt.Sprintf("%s %s/%s: %s", d.Ref.Kind, d.Ref.Namespace, d.Ref.Name, d.Path)
+}
+
+// FindDrift compares the rendered objects with their live state and with the
+// manifest last applied by the release. Only the fields set by the chart are
+// compared, so that the defaults set by the API server and the fields owned
+// by other controllers are not reported; the fields whose rendered value
+// changed since the release was last applied are pending updates, not drift.
+// Missing objects are left to CheckResource.
+func FindDrift(ctx context.Context, rendered []*unstructured.Unstructured, manifest string, opts CheckResourceOptions) ([]Drift, error) {
+	applied, err := parseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Drift{}
+	for _, el := range rendered {
+		ref := ObjectRefFor(el)
+
+		live, err := getLive(ctx, ref, opts)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var last map[string]interface{}
+		if obj, ok := applied[manifestKey(el)]; ok {
+			last = driftFields(obj)
+		}
+
+		path, ok := diffFields(driftFields(el), last, driftFields(live), "")
+		if !ok {
+			res = append(res, Drift{Ref: ref, Path: path})
+		}
+	}
+	return res, nil
+}
+
+// driftFields returns the fields of the supplied object set by a chart: the
+// identity and the server managed metadata fields are left out, as well as
+// the status. The stringData of the Secrets is folded into their data, as
+// the API server does.
+func driftFields(el *unstructured.Unstructured) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range el.Object {
+		switch k {
+		case "apiVersion", "kind", "status":
+		case "metadata":
+			md := map[string]interface{}{}
+			for _, f := range []string{"labels", "annotations"} {
+				if v, ok, _ := unstructured.NestedFieldNoCopy(el.Object, "metadata", f); ok {
+					md[f] = v
+				}
+			}
+			res[k] = md
+		default:
+			res[k] = v
+		}
+	}
+
+	if el.GetAPIVersion() != "v1" || el.GetKind() != "Secret" {
+		return res
+	}
+
+	sd, ok := res["stringData"].(map[string]interface{})
+	if !ok {
+		return res
+	}
+	data, _ := res["data"].(map[string]interface{})
+	merged := make(map[string]interface{}, len(data)+len(sd))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range sd {
+		merged[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+	}
+	res["data"] = merged
+	delete(res, "stringData")
+
+	return res
+}
+
+// diffFields returns the path of the first field of desired whose value
+// differs in live, skipping the fields whose value differs from the last
+// applied one too. A nil applied value means there is nothing to skip.
+func diffFields(desired, applied, live interface{}, path string) (string, bool) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return path, changed(desired, applied)
+		}
+		a, hasApplied := applied.(map[string]interface{})
+
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			var av interface{}
+			if hasApplied {
+				v, ok := a[k]
+				if !ok {
+					// Added since last applied.
+					continue
+				}
+				av = v
+			}
+
+			lv, ok := l[k]
+			if !ok {
+				if d[k] == nil {
+					continue
+				}
+				return joinPath(path, k), changed(d[k], av)
+			}
+			if p, ok := diffFields(d[k], av, lv, joinPath(path, k)); !ok {
+				return p, false
+			}
+		}
+		return "", true
+
+	case []interface{}:
+		a, hasApplied := applied.([]interface{})
+		if hasApplied && len(a) != len(d) {
+			// Resized since last applied.
+			return "", true
+		}
+
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return path, changed(desired, applied)
+		}
+
+		for i := range d {
+			var av interface{}
+			if hasApplied {
+				av = a[i]
+			}
+			if p, ok := diffFields(d[i], av, l[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return p, false
+			}
+		}
+		return "", true
+
+	default:
+		if equalValues(desired, live) {
+			return "", true
+		}
+		return path, changed(desired, applied)
+	}
+}
+
+// changed returns true, meaning no drift, if the desired value changed since
+// it was last applied.
+func changed(desired, applied interface{}) bool {
+	if applied == nil {
+		return false
+	}
+	_, ok := diffFields(desired, nil, applied, "")
+	return !ok
+}
+
+// equalValues compares two scalar values, tolerating the normalizations made
+// by the API server on numbers and quantities (e.g. 1000m and 1).
+func equalValues(a, b interface{}) bool {
+	if fmt.Sprint(a) == fmt.Sprint(b) {
+		return true
+	}
+
+	sa, ok1 := a.(string)
+	sb, ok2 := b.(string)
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	qa, err := resource.ParseQuantity(sa)
+	if err != nil {
+		return false
+	}
+	qb, err := resource.ParseQuantity(sb)
+	if err != nil {
+		return false
+	}
+	return qa.Cmp(qb) == 0
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// parseManifest returns the objects of the supplied release manifest by manifestKey.
+func parseManifest(manifest string) (map[string]*unstructured.Unstructured, error) {
+	res := map[string]*unstructured.Unstructured{}
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		dat, err := sigsyaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, fmt.Errorf("parsing release manifest: %w", err)
+		}
+		if len(strings.TrimSpace(string(dat))) == 0 || string(dat) == "null" {
+			continue
+		}
+
+		el := &unstructured.Unstructured{}
+		if err := el.UnmarshalJSON(dat); err != nil {
+			return nil, fmt.Errorf("parsing release manifest: %w", err)
+		}
+		res[manifestKey(el)] = el
+	}
+	return res, nil
+}
+
+// manifestKey identifies an object of a release regardless of its namespace,
+// which is often omitted from the manifests.
+func manifestKey(el *unstructured.Unstructured) string {
+	return el.GetAPIVersion() + "/" + el.GetKind() + "/" + el.GetName()
+}
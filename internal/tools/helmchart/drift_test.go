@@ -0,0 +1,102 @@
+package helmchart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffFields(t *testing.T) {
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  "app",
+							"image": "nginx:1.27",
+							"resources": map[string]interface{}{
+								"limits": map[string]interface{}{"cpu": "1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	live := func(replicas interface{}, image string) map[string]interface{} {
+		return map[string]interface{}{
+			"spec": map[string]interface{}{
+				"replicas":             replicas,
+				"revisionHistoryLimit": int64(10),
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":            "app",
+								"image":           image,
+								"imagePullPolicy": "IfNotPresent",
+								"resources": map[string]interface{}{
+									"limits": map[string]interface{}{"cpu": "1000m"},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	// Server defaulted fields and normalized values are not drift.
+	path, ok := diffFields(desired, nil, live(float64(2), "nginx:1.27"), "")
+	assert.True(t, ok)
+	assert.Empty(t, path)
+
+	path, ok = diffFields(desired, nil, live(int64(5), "nginx:1.27"), "")
+	assert.False(t, ok)
+	assert.Equal(t, "spec.replicas", path)
+
+	path, ok = diffFields(desired, nil, live(int64(2), "nginx:latest"), "")
+	assert.False(t, ok)
+	assert.Equal(t, "spec.template.spec.containers[0].image", path)
+
+	// Values changed since last applied are pending updates.
+	applied := live(int64(5), "nginx:1.27")
+	_, ok = diffFields(desired, applied, live(int64(5), "nginx:1.27"), "")
+	assert.True(t, ok)
+
+	// Removed fields are drift.
+	removed := live(int64(2), "nginx:1.27")
+	delete(removed["spec"].(map[string]interface{}), "replicas")
+	path, ok = diffFields(desired, desired, removed, "")
+	assert.False(t, ok)
+	assert.Equal(t, "spec.replicas", path)
+}
+
+func TestDriftFieldsSecret(t *testing.T) {
+	el := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            "demo",
+			"namespace":       "demo-system",
+			"resourceVersion": "42",
+			"labels":          map[string]interface{}{"app": "demo"},
+		},
+		"data":       map[string]interface{}{"password": "czNjcjN0"},
+		"stringData": map[string]interface{}{"username": "admin"},
+	}}
+
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app": "demo"},
+		},
+		"data": map[string]interface{}{
+			"password": "czNjcjN0",
+			"username": "YWRtaW4=",
+		},
+	}, driftFields(el))
+}
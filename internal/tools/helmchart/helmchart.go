@@ -11,9 +11,9 @@ import (
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
 
 	"helm.sh/helm/v3/pkg/release"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -49,7 +49,33 @@ type RenderTemplateOptions struct {
 	Credentials    *Credentials
 }
 
+// RenderTemplate renders the chart for the supplied resource and returns
+// the references to the rendered objects, hooks excluded.
 func RenderTemplate(ctx context.Context, opts RenderTemplateOptions) ([]controller.ObjectRef, error) {
+	all, err := RenderManifests(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]controller.ObjectRef, 0, len(all))
+	for _, el := range all {
+		res = append(res, ObjectRefFor(el))
+	}
+	return res, nil
+}
+
+// ObjectRefFor returns the reference to the supplied object.
+func ObjectRefFor(el *unstructured.Unstructured) controller.ObjectRef {
+	return controller.ObjectRef{
+		APIVersion: el.GetAPIVersion(),
+		Kind:       el.GetKind(),
+		Name:       el.GetName(),
+		Namespace:  el.GetNamespace(),
+	}
+}
+
+// RenderManifests renders the chart for the supplied resource, hooks excluded.
+func RenderManifests(ctx context.Context, opts RenderTemplateOptions) ([]*unstructured.Unstructured, error) {
 	dat, err := ExtractValuesFromSpec(opts.Resource)
 	if err != nil {
 		return nil, err
@@ -73,7 +99,7 @@ func RenderTemplate(ctx context.Context, opts RenderTemplateOptions) ([]controll
 		return nil, err
 	}
 
-	all := []controller.ObjectRef{}
+	all := []*unstructured.Unstructured{}
 
 	for _, spec := range strings.Split(string(tpl), "---") {
 		if len(spec) == 0 {
@@ -90,7 +116,7 @@ func RenderTemplate(ctx context.Context, opts RenderTemplateOptions) ([]controll
 			continue
 		}
 
-		obj, gvk, err := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme).Decode(rawObj.Raw, nil, nil)
+		obj, _, err := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme).Decode(rawObj.Raw, nil, nil)
 		if err != nil {
 			return all, err
 		}
@@ -110,38 +136,19 @@ func RenderTemplate(ctx context.Context, opts RenderTemplateOptions) ([]controll
 			continue
 		}
 
-		apiVersion, kind := gvk.ToAPIVersionAndKind()
-		all = append(all, controller.ObjectRef{
-			APIVersion: apiVersion,
-			Kind:       kind,
-			Name:       unstructuredObj.GetName(),
-			Namespace:  unstructuredObj.GetNamespace(),
-		})
+		all = append(all, unstructuredObj)
 	}
 
 	return all, nil
 }
 
 type CheckResourceOptions struct {
-	DynamicClient   dynamic.Interface
-	DiscoveryClient *discovery.DiscoveryClient
+	DynamicClient dynamic.Interface
+	Mapper        apimeta.RESTMapper
 }
 
 func CheckResource(ctx context.Context, ref controller.ObjectRef, opts CheckResourceOptions) (*controller.ObjectRef, error) {
-	gvr, err := tools.GVKtoGVR(opts.DiscoveryClient, schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
-	if err != nil {
-		return nil, err
-	}
-
-	un, err := opts.DynamicClient.Resource(gvr).
-		Namespace(ref.Namespace).
-		Get(ctx, ref.Name, metav1.GetOptions{})
-	if un == nil {
-		// Try to get the resource without the namespace. This is useful for cluster-scoped resources.
-		un, err = opts.DynamicClient.Resource(gvr).
-			Get(ctx, ref.Name, metav1.GetOptions{})
-	}
-
+	un, err := getLive(ctx, ref, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +163,24 @@ func CheckResource(ctx context.Context, ref controller.ObjectRef, opts CheckReso
 	return nil, err
 }
 
+// getLive returns the live state of the referenced object.
+func getLive(ctx context.Context, ref controller.ObjectRef, opts CheckResourceOptions) (*unstructured.Unstructured, error) {
+	gvr, err := tools.GVKtoGVR(opts.Mapper, schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	if err != nil {
+		return nil, err
+	}
+
+	un, err := opts.DynamicClient.Resource(gvr).
+		Namespace(ref.Namespace).
+		Get(ctx, ref.Name, metav1.GetOptions{})
+	if un == nil {
+		// Try to get the resource without the namespace. This is useful for cluster-scoped resources.
+		un, err = opts.DynamicClient.Resource(gvr).
+			Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	return un, err
+}
+
 func FindRelease(hc helmclient.Client, name string) (*release.Release, error) {
 	all, err := hc.ListDeployedReleases()
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
 	"helm.sh/helm/v3/pkg/release"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -20,6 +21,10 @@ type InstallOptions struct {
 	Repo        string
 	Version     string
 	Credentials *Credentials
+	// Labels are set on the release.
+	Labels map[string]string
+	// Options override the default install options.
+	Options archive.ReleaseOptions
 }
 
 func Install(ctx context.Context, opts InstallOptions) (*release.Release, int64, error) {
@@ -31,8 +36,12 @@ func Install(ctx context.Context, opts InstallOptions) (*release.Release, int64,
 		ChartName:       opts.ChartName,
 		CreateNamespace: true,
 		UpgradeCRDs:     true,
+		Labels:          opts.Labels,
 		Wait:            false,
 	}
+	if err := applyReleaseOptions(&chartSpec, opts.Options); err != nil {
+		return nil, 0, err
+	}
 	if opts.Credentials != nil {
 		chartSpec.Username = opts.Credentials.Username
 		chartSpec.Password = opts.Credentials.Password
@@ -0,0 +1,91 @@
+package helmchart
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultWaitTimeout is the timeout of the operations that wait without one,
+// as for the Helm CLI.
+const defaultWaitTimeout = 5 * time.Minute
+
+// ReleaseOptionsFor returns the supplied definition options overridden by the
+// JSON object held by the supplied annotation of the resource, if any.
+func ReleaseOptionsFor(mg *unstructured.Unstructured, def archive.ReleaseOptions, annotation string) (archive.ReleaseOptions, error) {
+	val, ok := mg.GetAnnotations()[annotation]
+	if !ok || val == "" {
+		return def, nil
+	}
+
+	dat, err := json.Marshal(def)
+	if err != nil {
+		return def, err
+	}
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(dat, &merged); err != nil {
+		return def, err
+	}
+	if err := json.Unmarshal([]byte(val), &merged); err != nil {
+		return def, fmt.Errorf("parsing annotation %s: %w", annotation, err)
+	}
+
+	dat, err = json.Marshal(merged)
+	if err != nil {
+		return def, err
+	}
+	res := archive.ReleaseOptions{}
+	if err := json.Unmarshal(dat, &res); err != nil {
+		return def, fmt.Errorf("parsing annotation %s: %w", annotation, err)
+	}
+	return res, nil
+}
+
+// applyReleaseOptions sets the options that are set on the supplied chart spec.
+func applyReleaseOptions(spec *helmclient.ChartSpec, opts archive.ReleaseOptions) error {
+	flags := []struct {
+		val *bool
+		dst *bool
+	}{
+		{opts.Atomic, &spec.Atomic},
+		{opts.CleanupOnFail, &spec.CleanupOnFail},
+		{opts.CreateNamespace, &spec.CreateNamespace},
+		{opts.DisableHooks, &spec.DisableHooks},
+		{opts.Force, &spec.Force},
+		{opts.Recreate, &spec.Recreate},
+		{opts.Replace, &spec.Replace},
+		{opts.ResetValues, &spec.ResetValues},
+		{opts.ReuseValues, &spec.ReuseValues},
+		{opts.SkipCRDs, &spec.SkipCRDs},
+		{opts.SubNotes, &spec.SubNotes},
+		{opts.UpgradeCRDs, &spec.UpgradeCRDs},
+		{opts.Wait, &spec.Wait},
+		{opts.WaitForJobs, &spec.WaitForJobs},
+	}
+	for _, el := range flags {
+		if el.val != nil {
+			*el.dst = *el.val
+		}
+	}
+
+	if opts.MaxHistory != nil {
+		spec.MaxHistory = *opts.MaxHistory
+	}
+
+	if opts.Timeout != "" {
+		d, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return fmt.Errorf("parsing timeout: %w", err)
+		}
+		spec.Timeout = d
+	}
+
+	if (spec.Wait || spec.WaitForJobs || spec.Atomic) && spec.Timeout <= 0 {
+		spec.Timeout = defaultWaitTimeout
+	}
+	return nil
+}
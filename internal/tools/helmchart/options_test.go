@@ -0,0 +1,65 @@
+package helmchart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReleaseOptionsFor(t *testing.T) {
+	yes, no, history := true, false, 5
+	def := archive.ReleaseOptions{Wait: &yes, Force: &yes, MaxHistory: &history, Timeout: "10m"}
+
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	res, err := ReleaseOptionsFor(mg, def, meta.AnnotationKeyUpgradeOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, def, res)
+
+	meta.AddAnnotations(mg, map[string]string{
+		meta.AnnotationKeyUpgradeOptions: `{"force": false, "timeout": "2m", "cleanupOnFail": true}`,
+	})
+	res, err = ReleaseOptionsFor(mg, def, meta.AnnotationKeyUpgradeOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, archive.ReleaseOptions{
+		Wait:          &yes,
+		Force:         &no,
+		CleanupOnFail: &yes,
+		MaxHistory:    &history,
+		Timeout:       "2m",
+	}, res)
+	assert.True(t, *def.Force)
+
+	meta.AddAnnotations(mg, map[string]string{meta.AnnotationKeyUpgradeOptions: `{"force": "yes"}`})
+	_, err = ReleaseOptionsFor(mg, def, meta.AnnotationKeyUpgradeOptions)
+	assert.Error(t, err)
+}
+
+func TestApplyReleaseOptions(t *testing.T) {
+	yes, no, history := true, false, 3
+
+	spec := helmclient.ChartSpec{CreateNamespace: true, UpgradeCRDs: true}
+	assert.NoError(t, applyReleaseOptions(&spec, archive.ReleaseOptions{}))
+	assert.Equal(t, helmclient.ChartSpec{CreateNamespace: true, UpgradeCRDs: true}, spec)
+
+	assert.NoError(t, applyReleaseOptions(&spec, archive.ReleaseOptions{
+		CreateNamespace: &no,
+		Wait:            &yes,
+		MaxHistory:      &history,
+	}))
+	assert.Equal(t, helmclient.ChartSpec{
+		UpgradeCRDs: true,
+		Wait:        true,
+		MaxHistory:  3,
+		Timeout:     defaultWaitTimeout,
+	}, spec)
+
+	assert.NoError(t, applyReleaseOptions(&spec, archive.ReleaseOptions{Timeout: "90s"}))
+	assert.Equal(t, 90*time.Second, spec.Timeout)
+
+	assert.Error(t, applyReleaseOptions(&spec, archive.ReleaseOptions{Timeout: "soon"}))
+}
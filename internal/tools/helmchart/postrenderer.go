@@ -23,7 +23,7 @@ func (r *labelsPostRender) Run(renderedManifests *bytes.Buffer) (modifiedManifes
 			labels = make(map[string]string)
 		}
 		// your labels
-		labels["krateo.io/composition-id"] = string(r.UID)
+		labels[LabelCompositionID] = string(r.UID)
 		v.SetLabels(labels)
 	}
 
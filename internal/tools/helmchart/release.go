@@ -0,0 +1,114 @@
+package helmchart
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Labels tying a release to the managed resource it has been installed for.
+const (
+	LabelCompositionID      = "krateo.io/composition-id"
+	LabelCompositionGroup   = "krateo.io/composition-group"
+	LabelCompositionVersion = "krateo.io/composition-version"
+	LabelCompositionKind    = "krateo.io/composition-kind"
+	LabelDeletionPolicy     = meta.AnnotationKeyDeletionPolicy
+)
+
+// ReleaseLabels returns the labels of the release of the supplied managed resource.
+// The effective deletion policy is recorded as well, so that the release can be
+// handled properly should the managed resource vanish.
+// The UID is left out if unknown, upgrades keeping the one set on install.
+func ReleaseLabels(mg *unstructured.Unstructured, deletionPolicy string) map[string]string {
+	gvk := mg.GroupVersionKind()
+
+	res := map[string]string{
+		LabelCompositionGroup:   gvk.Group,
+		LabelCompositionVersion: gvk.Version,
+		LabelCompositionKind:    gvk.Kind,
+		LabelDeletionPolicy:     meta.GetDeletionPolicy(mg, deletionPolicy),
+	}
+	if uid := mg.GetUID(); uid != "" {
+		res[LabelCompositionID] = string(uid)
+	}
+	return res
+}
+
+// ManagedResource rebuilds the last known state of the managed resource the
+// release has been installed for. It returns false if the release has not
+// been installed for a managed resource of the supplied kind.
+func ManagedResource(rel *release.Release, gk schema.GroupKind) (*unstructured.Unstructured, bool) {
+	if rel == nil || rel.Labels == nil {
+		return nil, false
+	}
+
+	if rel.Labels[LabelCompositionGroup] != gk.Group || rel.Labels[LabelCompositionKind] != gk.Kind {
+		return nil, false
+	}
+
+	el := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	el.SetGroupVersionKind(gk.WithVersion(rel.Labels[LabelCompositionVersion]))
+	el.SetName(rel.Name)
+	el.SetNamespace(rel.Namespace)
+	el.SetUID(types.UID(rel.Labels[LabelCompositionID]))
+	if policy := rel.Labels[LabelDeletionPolicy]; policy != "" {
+		meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyDeletionPolicy: policy})
+	}
+
+	return el, true
+}
+
+// ReleaseStatus returns the status fields describing the supplied release:
+// revision, status, chart name and version, app version, last deployed time
+// and a digest of the rendered notes.
+func ReleaseStatus(rel *release.Release) map[string]interface{} {
+	res := map[string]interface{}{
+		"name":     rel.Name,
+		"revision": int64(rel.Version),
+	}
+
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		res["chart"] = rel.Chart.Metadata.Name
+		res["version"] = rel.Chart.Metadata.Version
+		if rel.Chart.Metadata.AppVersion != "" {
+			res["appVersion"] = rel.Chart.Metadata.AppVersion
+		}
+	}
+
+	if rel.Info != nil {
+		res["status"] = rel.Info.Status.String()
+		if !rel.Info.LastDeployed.IsZero() {
+			res["lastDeployed"] = rel.Info.LastDeployed.UTC().Format(time.RFC3339)
+		}
+		if rel.Info.Notes != "" {
+			res["notesDigest"] = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(rel.Info.Notes)))
+		}
+	}
+
+	return res
+}
+
+// ManagedRefs returns the references to the supplied rendered objects, as
+// recorded in the status of the managed resource.
+func ManagedRefs(rendered []*unstructured.Unstructured) []interface{} {
+	res := make([]interface{}, 0, len(rendered))
+	for _, el := range rendered {
+		ref := ObjectRefFor(el)
+		item := map[string]interface{}{
+			"apiVersion": ref.APIVersion,
+			"kind":       ref.Kind,
+			"name":       ref.Name,
+		}
+		if ref.Namespace != "" {
+			item["namespace"] = ref.Namespace
+		}
+		res = append(res, item)
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+package helmchart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestManagedResource(t *testing.T) {
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	mg.SetAPIVersion("composition.krateo.io/v1-2-0")
+	mg.SetKind("FireworksApp")
+	mg.SetName("demo")
+	mg.SetNamespace("demo-system")
+	mg.SetUID("1234")
+	meta.AddAnnotations(mg, map[string]string{meta.AnnotationKeyDeletionPolicy: "orphan"})
+
+	rel := &release.Release{
+		Name:      "demo",
+		Namespace: "demo-system",
+		Labels:    ReleaseLabels(mg, ""),
+	}
+
+	el, ok := ManagedResource(rel, schema.GroupKind{Group: "composition.krateo.io", Kind: "FireworksApp"})
+	assert.True(t, ok)
+	assert.Equal(t, mg.GetAPIVersion(), el.GetAPIVersion())
+	assert.Equal(t, mg.GetKind(), el.GetKind())
+	assert.Equal(t, mg.GetName(), el.GetName())
+	assert.Equal(t, mg.GetNamespace(), el.GetNamespace())
+	assert.Equal(t, mg.GetUID(), el.GetUID())
+	assert.Equal(t, meta.DeletionPolicyOrphan, meta.GetDeletionPolicy(el, ""))
+
+	_, ok = ManagedResource(rel, schema.GroupKind{Group: "composition.krateo.io", Kind: "Other"})
+	assert.False(t, ok)
+
+	_, ok = ManagedResource(&release.Release{Name: "unlabeled"}, schema.GroupKind{Group: "composition.krateo.io", Kind: "FireworksApp"})
+	assert.False(t, ok)
+}
+
+func TestReleaseLabels(t *testing.T) {
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	mg.SetAPIVersion("composition.krateo.io/v1-2-0")
+	mg.SetKind("FireworksApp")
+	mg.SetName("demo")
+	mg.SetUID("1234")
+
+	installed := ReleaseLabels(mg, "")
+
+	// Upgrades are requested with the UID stripped from the resource.
+	upgraded := mg.DeepCopy()
+	upgraded.SetUID("")
+	meta.AddAnnotations(upgraded, map[string]string{meta.AnnotationKeyDeletionPolicy: "orphan"})
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "install",
+			labels: installed,
+			want: map[string]string{
+				LabelCompositionID:      "1234",
+				LabelCompositionGroup:   "composition.krateo.io",
+				LabelCompositionVersion: "v1-2-0",
+				LabelCompositionKind:    "FireworksApp",
+				LabelDeletionPolicy:     meta.DeletionPolicyDelete,
+			},
+		},
+		{
+			name:   "upgrade",
+			labels: ReleaseLabels(upgraded, ""),
+			want: map[string]string{
+				LabelCompositionGroup:   "composition.krateo.io",
+				LabelCompositionVersion: "v1-2-0",
+				LabelCompositionKind:    "FireworksApp",
+				LabelDeletionPolicy:     meta.DeletionPolicyOrphan,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.labels)
+		})
+	}
+
+	// Helm merges the upgrade labels into the installed ones.
+	merged := map[string]string{}
+	for _, labels := range []map[string]string{installed, ReleaseLabels(upgraded, "")} {
+		for k, v := range labels {
+			merged[k] = v
+		}
+	}
+	el, ok := ManagedResource(&release.Release{Name: "demo", Labels: merged},
+		schema.GroupKind{Group: "composition.krateo.io", Kind: "FireworksApp"})
+	assert.True(t, ok)
+	assert.Equal(t, mg.GetUID(), el.GetUID())
+	assert.Equal(t, meta.DeletionPolicyOrphan, meta.GetDeletionPolicy(el, ""))
+}
+
+func TestReleaseStatus(t *testing.T) {
+	rel := &release.Release{
+		Name:    "demo",
+		Version: 3,
+		Chart: &chart.Chart{Metadata: &chart.Metadata{
+			Name:       "fireworks-app",
+			Version:    "0.1.0",
+			AppVersion: "1.27",
+		}},
+		Info: &release.Info{
+			Status:       release.StatusDeployed,
+			LastDeployed: helmtime.Time{Time: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+			Notes:        "hello",
+		},
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"name":         "demo",
+		"revision":     int64(3),
+		"chart":        "fireworks-app",
+		"version":      "0.1.0",
+		"appVersion":   "1.27",
+		"status":       "deployed",
+		"lastDeployed": "2024-06-01T10:00:00Z",
+		"notesDigest":  "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}, ReleaseStatus(rel))
+
+	assert.Equal(t, map[string]interface{}{
+		"name":     "bare",
+		"revision": int64(1),
+	}, ReleaseStatus(&release.Release{Name: "bare", Version: 1}))
+}
+
+func TestManagedRefs(t *testing.T) {
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName("demo")
+	cm.SetNamespace("demo-system")
+
+	ns := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName("demo-system")
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "name": "demo", "namespace": "demo-system"},
+		map[string]interface{}{"apiVersion": "v1", "kind": "Namespace", "name": "demo-system"},
+	}, ManagedRefs([]*unstructured.Unstructured{cm, ns}))
+}
@@ -2,8 +2,12 @@ package helmchart
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"helm.sh/helm/v3/pkg/release"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -14,6 +18,32 @@ type UpdateOptions struct {
 	Resource    *unstructured.Unstructured
 	Repo        string
 	Credentials *Credentials
+	// Labels are set on the release.
+	Labels map[string]string
+	// Timeout, when set, is how long the upgraded resources are waited
+	// for to become ready before the upgrade is considered failed.
+	Timeout time.Duration
+	// RollbackOnFailure rolls the release back to its last deployed
+	// revision when the upgrade fails.
+	RollbackOnFailure bool
+	// Options override the default upgrade options.
+	Options archive.ReleaseOptions
+}
+
+// RollbackError reports an upgrade that failed and has been rolled back.
+type RollbackError struct {
+	Err              error
+	FailedRevision   int
+	RestoredRevision int
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("upgrade to revision %d failed, rolled back to revision %d: %s",
+		e.FailedRevision, e.RestoredRevision, e.Err.Error())
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
 }
 
 func Update(ctx context.Context, opts UpdateOptions) error {
@@ -24,8 +54,13 @@ func Update(ctx context.Context, opts UpdateOptions) error {
 		Version:         opts.Version,
 		CreateNamespace: true,
 		UpgradeCRDs:     true,
+		Labels:          opts.Labels,
 		Replace:         true,
 	}
+	if opts.Timeout > 0 {
+		chartSpec.Wait = true
+		chartSpec.Timeout = opts.Timeout
+	}
 
 	dat, err := ExtractValuesFromSpec(opts.Resource)
 	if err != nil {
@@ -35,7 +70,56 @@ func Update(ctx context.Context, opts UpdateOptions) error {
 		chartSpec.ResetValues = true
 		chartSpec.ValuesYaml = string(dat)
 	}
+	if err := applyReleaseOptions(&chartSpec, opts.Options); err != nil {
+		return err
+	}
 
 	_, err = opts.HelmClient.UpgradeChart(ctx, &chartSpec, nil)
-	return err
+	if err == nil || !opts.RollbackOnFailure {
+		return err
+	}
+
+	history, herr := opts.HelmClient.ListReleaseHistory(chartSpec.ReleaseName, 0)
+	if herr != nil {
+		return fmt.Errorf("%w (listing release history for rollback: %v)", err, herr)
+	}
+
+	failed, restored, ok := rollbackRevisions(history)
+	if !ok {
+		return fmt.Errorf("%w (no deployed revision to roll back to)", err)
+	}
+
+	if rerr := opts.HelmClient.RollbackReleaseToRevision(&chartSpec, restored); rerr != nil {
+		return fmt.Errorf("%w (rollback to revision %d failed: %v)", err, restored, rerr)
+	}
+
+	return &RollbackError{Err: err, FailedRevision: failed, RestoredRevision: restored}
+}
+
+// rollbackRevisions returns the latest revision of the supplied release
+// history, if it failed, and the last revision that was successfully
+// deployed before it. Nothing is rolled back if the upgrade failed before
+// recording a revision, the latest one being still deployed.
+func rollbackRevisions(history []*release.Release) (failed, restored int, ok bool) {
+	var latest *release.Release
+	for _, el := range history {
+		if latest == nil || el.Version > latest.Version {
+			latest = el
+		}
+	}
+	if latest == nil || latest.Info == nil || latest.Info.Status == release.StatusDeployed {
+		return 0, 0, false
+	}
+	failed = latest.Version
+
+	for _, el := range history {
+		if el.Version >= failed || el.Version <= restored || el.Info == nil {
+			continue
+		}
+		if el.Info.Status == release.StatusDeployed || el.Info.Status == release.StatusSuperseded {
+			restored = el.Version
+		}
+	}
+
+	return failed, restored, restored > 0
 }
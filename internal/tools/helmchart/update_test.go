@@ -0,0 +1,39 @@
+package helmchart
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestRollbackRevisions(t *testing.T) {
+	rev := func(version int, status release.Status) *release.Release {
+		return &release.Release{Version: version, Info: &release.Info{Status: status}}
+	}
+
+	failed, restored, ok := rollbackRevisions([]*release.Release{
+		rev(1, release.StatusSuperseded),
+		rev(2, release.StatusDeployed),
+		rev(3, release.StatusFailed),
+		rev(4, release.StatusFailed),
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 4, failed)
+	assert.Equal(t, 2, restored)
+
+	_, _, ok = rollbackRevisions([]*release.Release{
+		rev(1, release.StatusFailed),
+	})
+	assert.False(t, ok)
+
+	// The upgrade failed before recording a revision.
+	_, _, ok = rollbackRevisions([]*release.Release{
+		rev(1, release.StatusSuperseded),
+		rev(2, release.StatusDeployed),
+	})
+	assert.False(t, ok)
+
+	_, _, ok = rollbackRevisions(nil)
+	assert.False(t, ok)
+}
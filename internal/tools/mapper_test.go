@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resettableMapper knows nothing until it is reset.
+type resettableMapper struct {
+	*apimeta.DefaultRESTMapper
+	gvk    schema.GroupVersionKind
+	resets int
+}
+
+func (m *resettableMapper) Reset() {
+	m.resets++
+	m.Add(m.gvk, apimeta.RESTScopeNamespace)
+}
+
+func TestGVKtoGVRResetsOnNoMatch(t *testing.T) {
+	gvk := schema.FromAPIVersionAndKind("dummy-charts.krateo.io/v0-2-0", "DummyChart")
+
+	mapper := &resettableMapper{
+		DefaultRESTMapper: apimeta.NewDefaultRESTMapper(nil),
+		gvk:               gvk,
+	}
+
+	gvr, err := GVKtoGVR(mapper, gvk)
+	assert.Nil(t, err)
+	assert.Equal(t, "dummycharts", gvr.Resource)
+	assert.Equal(t, 1, mapper.resets)
+
+	_, err = GVKtoGVR(mapper, gvk)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, mapper.resets)
+
+	_, err = GVKtoGVR(mapper, schema.FromAPIVersionAndKind("example.org/v1", "Unknown"))
+	assert.True(t, apimeta.IsNoMatchError(err))
+	assert.Equal(t, 2, mapper.resets)
+}
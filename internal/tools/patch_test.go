@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestStatusMergePatch(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": "42"},
+		"status": map[string]interface{}{
+			"id":              "1",
+			"failedObjectRef": map[string]interface{}{"name": "demo"},
+		},
+	}}
+
+	desired := live.DeepCopy()
+	dat, err := statusMergePatch(live, desired)
+	assert.Nil(t, err)
+	assert.Nil(t, dat)
+
+	unstructured.RemoveNestedField(desired.Object, "status", "failedObjectRef")
+	_ = unstructured.SetNestedField(desired.Object, "2", "status", "id")
+
+	dat, err = statusMergePatch(live, desired)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"status":{"failedObjectRef":null,"id":"2"}}`, string(dat))
+
+	// Fields written meanwhile by others are left untouched.
+	_ = unstructured.SetNestedField(live.Object, "x", "status", "other")
+	dat, err = guardedMergePatch(live, dat)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"metadata":{"resourceVersion":"42"},"status":{"failedObjectRef":null,"id":"2"}}`, string(dat))
+
+	// Nothing left to write.
+	_ = unstructured.SetNestedField(live.Object, "2", "status", "id")
+	unstructured.RemoveNestedField(live.Object, "status", "failedObjectRef")
+	dat, err = guardedMergePatch(live, []byte(`{"status":{"failedObjectRef":null,"id":"2"}}`))
+	assert.Nil(t, err)
+	assert.Nil(t, dat)
+}
+
+func TestPatchResourceStatus(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "dummies"}
+
+	newLive := func(rv string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "composition.krateo.io/v1",
+			"kind":       "Dummy",
+			"metadata": map[string]interface{}{
+				"name":            "demo",
+				"namespace":       "default",
+				"resourceVersion": rv,
+			},
+			"status": map[string]interface{}{"id": "1"},
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		liveRV    string
+		desired   string
+		conflicts int
+		err       bool
+	}{
+		{name: "same base", liveRV: "1", desired: "1"},
+		{name: "no resource version", liveRV: "1", desired: ""},
+		{name: "stale base", liveRV: "3", desired: "1"},
+		{name: "concurrent write", liveRV: "1", desired: "1", conflicts: 1},
+		{name: "conflicts exhausted", liveRV: "1", desired: "1", conflicts: 10, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{gvr: "DummyList"}, newLive(tc.liveRV))
+			res := cli.Resource(gvr).Namespace("default")
+
+			// Someone else writes the status right before each of our patches.
+			conflicts := tc.conflicts
+			cli.PrependReactor("patch", "dummies", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if conflicts == 0 {
+					return false, nil, nil
+				}
+				conflicts--
+
+				obj, err := cli.Tracker().Get(gvr, "default", "demo")
+				if err != nil {
+					return true, nil, err
+				}
+				live := obj.(*unstructured.Unstructured)
+				_ = unstructured.SetNestedField(live.Object, "x", "status", "other")
+				live.SetResourceVersion(live.GetResourceVersion() + "0")
+				if err := cli.Tracker().Update(gvr, live, "default"); err != nil {
+					return true, nil, err
+				}
+				return true, nil, apierrors.NewConflict(gvr.GroupResource(), "demo", errors.New("modified"))
+			})
+
+			el := newLive(tc.desired)
+			_ = unstructured.SetNestedField(el.Object, "2", "status", "id")
+
+			err := PatchResourceStatus(context.TODO(), res, el)
+			assert.Equal(t, tc.err, err != nil)
+
+			live, err := res.Get(context.TODO(), "demo", metav1.GetOptions{})
+			assert.Nil(t, err)
+			id, _, _ := unstructured.NestedString(live.Object, "status", "id")
+			if tc.err {
+				assert.Equal(t, "1", id)
+				return
+			}
+			assert.Equal(t, "2", id)
+			if tc.conflicts > 0 {
+				other, _, _ := unstructured.NestedString(live.Object, "status", "other")
+				assert.Equal(t, "x", other)
+			}
+		})
+	}
+}
@@ -38,6 +38,16 @@ type Resource struct {
 	Identifiers []string `json:"identifiers"`
 	// VerbsDescription: the list of verbs to use on this resource
 	VerbsDescription []VerbsDescription `json:"verbsDescription"`
+	// ConnectionDetails: the response fields to publish as connection details
+	// +optional
+	ConnectionDetails []ConnectionDetail `json:"connectionDetails,omitempty"`
+}
+
+type ConnectionDetail struct {
+	// Name: the key of the connection detail
+	Name string `json:"name"`
+	// Path: the dot separated path of the field in the response body (e.g. credentials.token)
+	Path string `json:"path"`
 }
 
 type GVK struct {
@@ -74,6 +84,12 @@ type Info struct {
 
 	// Verbose: if true, the client will dump verbose output
 	Verbose bool `json:"verbose,omitempty"`
+
+	// DeletionPolicy: the deletion policy of the definition [Delete, Orphan]
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// PollInterval: the interval the resources are observed with (e.g. 15s)
+	PollInterval string `json:"pollInterval,omitempty"`
 }
 
 type Getter interface {
@@ -168,6 +184,16 @@ func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
 			continue
 		}
 
+		deletionPolicy, _, err := unstructured.NestedString(item.Object, "spec", "deletionPolicy")
+		if err != nil {
+			return nil, err
+		}
+
+		pollInterval, _, err := unstructured.NestedString(item.Object, "spec", "pollInterval")
+		if err != nil {
+			return nil, err
+		}
+
 		oasPath, ok, err := unstructured.NestedString(item.Object, "spec", "oasPath")
 		if !ok {
 			return nil, fmt.Errorf("missing spec.oasPath in definition for '%v' in namespace: %s", gvr, un.GetNamespace())
@@ -197,9 +223,11 @@ func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
 
 			if resource.Kind == gvk.Kind {
 				return &Info{
-					URL:      oasPath,
-					Resource: resource,
-					Auth:     auth,
+					URL:            oasPath,
+					Resource:       resource,
+					Auth:           auth,
+					DeletionPolicy: deletionPolicy,
+					PollInterval:   pollInterval,
 				}, nil
 			}
 		}
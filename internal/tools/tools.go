@@ -2,56 +2,214 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/retry"
 )
 
+// FieldManager is the field manager used for all the writes
+// performed by the controller on the managed resources.
+const FieldManager = "composition-dynamic-controller"
+
+// managedAnnotations are the annotations owned by the controller.
+var managedAnnotations = []string{
+	meta.AnnotationKeyExternalCreatePending,
+	meta.AnnotationKeyExternalCreateSucceeded,
+	meta.AnnotationKeyExternalCreateFailed,
+}
+
 type UpdateOptions struct {
-	DiscoveryClient *discovery.DiscoveryClient
-	DynamicClient   dynamic.Interface
+	Mapper        apimeta.RESTMapper
+	DynamicClient dynamic.Interface
 }
 
-func Update(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptions) error {
-	gvr, err := GVKtoGVR(opts.DiscoveryClient, el.GroupVersionKind())
+// PatchAnnotations merge patches the annotations owned by the controller,
+// removing the ones that are not set on the supplied object anymore.
+// Annotations owned by users or other controllers are left untouched.
+func PatchAnnotations(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptions) error {
+	gvr, err := GVKtoGVR(opts.Mapper, el.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+
+	all := el.GetAnnotations()
+	annotations := make(map[string]interface{}, len(managedAnnotations))
+	for _, k := range managedAnnotations {
+		if v, ok := all[k]; ok {
+			annotations[k] = v
+		} else {
+			annotations[k] = nil
+		}
+	}
+
+	dat, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	_, err = opts.DynamicClient.Resource(gvr).
+	res, err := opts.DynamicClient.Resource(gvr).
 		Namespace(el.GetNamespace()).
-		Update(ctx, el, metav1.UpdateOptions{
-			FieldValidation: "Ignore",
+		Patch(ctx, el.GetName(), types.MergePatchType, dat, metav1.PatchOptions{
+			FieldManager: FieldManager,
 		})
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Only metadata changed: status patches can follow from the new version.
+	el.SetResourceVersion(res.GetResourceVersion())
+	return nil
 }
 
-func UpdateStatus(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptions) error {
-	gvr, err := GVKtoGVR(opts.DiscoveryClient, el.GroupVersionKind())
+// PatchStatus merge patches the status subresource with the fields of the
+// status of the supplied object that differ from the live status.
+// The patch is guarded by the live resourceVersion and, on conflict, retried
+// against the new live status with the same fields only, so that neither
+// concurrent edits nor the status fields written meanwhile are lost.
+func PatchStatus(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptions) error {
+	gvr, err := GVKtoGVR(opts.Mapper, el.GroupVersionKind())
 	if err != nil {
 		return err
 	}
 
-	_, err = opts.DynamicClient.Resource(gvr).
-		Namespace(el.GetNamespace()).
-		UpdateStatus(ctx, el, metav1.UpdateOptions{})
+	return PatchResourceStatus(ctx, opts.DynamicClient.Resource(gvr).Namespace(el.GetNamespace()), el)
+}
 
-	return err
+// PatchResourceStatus is like PatchStatus but uses the supplied resource client.
+// On success the resourceVersion of the supplied object is updated, so that
+// further patches can be chained.
+func PatchResourceStatus(ctx context.Context, cli dynamic.ResourceInterface, el *unstructured.Unstructured) error {
+	live, err := cli.Get(ctx, el.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	written, err := statusMergePatch(live, el)
+	if err != nil || written == nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if live == nil {
+			if live, err = cli.Get(ctx, el.GetName(), metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		dat, err := guardedMergePatch(live, written)
+		live = nil
+		if err != nil || dat == nil {
+			return err
+		}
+
+		res, err := cli.Patch(ctx, el.GetName(), types.MergePatchType, dat, metav1.PatchOptions{
+			FieldManager: FieldManager,
+		}, "status")
+		if err != nil {
+			return err
+		}
+
+		el.SetResourceVersion(res.GetResourceVersion())
+		return nil
+	})
 }
 
-func GVKtoGVR(dc *discovery.DiscoveryClient, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
-	groupResources, err := restmapper.GetAPIGroupResources(dc)
+// statusMergePatch returns the merge patch turning the status of live into the
+// status of desired, or nil if there are no differences.
+func statusMergePatch(live, desired *unstructured.Unstructured) ([]byte, error) {
+	cur, err := json.Marshal(map[string]interface{}{"status": live.Object["status"]})
 	if err != nil {
-		return schema.GroupVersionResource{}, err
+		return nil, err
+	}
+
+	mod, err := json.Marshal(map[string]interface{}{"status": desired.Object["status"]})
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := jsonpatch.CreateMergePatch(cur, mod)
+	if err != nil {
+		return nil, err
+	}
+	if string(dat) == "{}" {
+		return nil, nil
+	}
+	return dat, nil
+}
+
+// guardedMergePatch returns the supplied status merge patch reduced to the
+// fields it still changes in the status of live and guarded by the
+// resourceVersion of live, or nil if there is nothing left to change.
+func guardedMergePatch(live *unstructured.Unstructured, written []byte) ([]byte, error) {
+	cur, err := json.Marshal(map[string]interface{}{"status": live.Object["status"]})
+	if err != nil {
+		return nil, err
 	}
 
-	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
+	mod, err := jsonpatch.MergePatch(cur, written)
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := jsonpatch.CreateMergePatch(cur, mod)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := map[string]interface{}{}
+	if err := json.Unmarshal(dat, &patch); err != nil {
+		return nil, err
+	}
+	if len(patch) == 0 {
+		return nil, nil
+	}
+
+	patch["metadata"] = map[string]interface{}{
+		"resourceVersion": live.GetResourceVersion(),
+	}
+	return json.Marshal(patch)
+}
+
+// NewRESTMapper returns a RESTMapper backed by an in-memory cached discovery.
+// The discovery is deferred until the first lookup and the cache is shared
+// by all the callers.
+func NewRESTMapper(cfg *rest.Config) (apimeta.ResettableRESTMapper, error) {
+	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dis)), nil
+}
+
+// GVKtoGVR maps the supplied GroupVersionKind to its GroupVersionResource.
+// If the mapper is resettable and the kind is unknown, the discovery cache
+// is invalidated and the lookup retried once, so that newly installed CRDs
+// are picked up.
+func GVKtoGVR(mapper apimeta.RESTMapper, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil && apimeta.IsNoMatchError(err) {
+		if rm, ok := mapper.(apimeta.ResettableRESTMapper); ok {
+			rm.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
 	if err != nil {
 		return schema.GroupVersionResource{}, err
 	}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -18,12 +17,12 @@ func TestGVKtoGVR(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
+	mapper, err := NewRESTMapper(cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	gvr, err := GVKtoGVR(dis, schema.FromAPIVersionAndKind("dummy-charts.krateo.io/v0-2-0", "DummyChart"))
+	gvr, err := GVKtoGVR(mapper, schema.FromAPIVersionAndKind("dummy-charts.krateo.io/v0-2-0", "DummyChart"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -10,6 +10,29 @@ const (
 	ReasonUnavailable = "Unavailable"
 	ReasonCreating    = "Creating"
 	ReasonDeleting    = "Deleting"
+
+	TypeSynced             = "Synced"
+	ReasonReconcilePaused  = "ReconcilePaused"
+	ReasonActionNotAllowed = "ActionNotAllowed"
+	ReasonReconcileError   = "ReconcileError"
+
+	TypeDrifted   = "Drifted"
+	ReasonNoDrift = "NoDrift"
+)
+
+// Reasons of the Events recorded on the lifecycle transitions
+// that have no matching condition.
+const (
+	ReasonCreated          = "Created"
+	ReasonCreateFailed     = "CreateFailed"
+	ReasonUpdating         = "Updating"
+	ReasonUpdated          = "Updated"
+	ReasonUpdateFailed     = "UpdateFailed"
+	ReasonDeleted          = "Deleted"
+	ReasonDeleteFailed     = "DeleteFailed"
+	ReasonDriftDetected    = "DriftDetected"
+	ReasonRetriesExhausted = "RetriesExhausted"
+	ReasonStatusPruned     = "StatusPruned"
 )
 
 func Unavailable() metav1.Condition {
@@ -63,6 +86,65 @@ func Available() metav1.Condition {
 	}
 }
 
+// ReconcilePaused returns a condition that indicates reconciliation on
+// the resource has been paused via the krateo.io/paused annotation.
+func ReconcilePaused() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeSynced,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReconcilePaused,
+		Message:            "Reconciliation is paused via the pause annotation",
+	}
+}
+
+// ActionNotAllowed returns a condition that indicates an action on the
+// external resource was suppressed by the resource management policy.
+func ActionNotAllowed(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeSynced,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonActionNotAllowed,
+		Message:            msg,
+	}
+}
+
+// ReconcileError returns a condition that indicates the controller gave up
+// retrying to reconcile the resource, reporting the last error encountered.
+func ReconcileError(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeSynced,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReconcileError,
+		Message:            msg,
+	}
+}
+
+// Drifted returns a condition that indicates the live state of the objects
+// installed for the resource differs from the rendered one.
+func Drifted(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDriftDetected,
+		Message:            msg,
+	}
+}
+
+// NoDrift returns a condition that indicates the live state of the objects
+// installed for the resource matches the rendered one.
+func NoDrift() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNoDrift,
+	}
+}
+
 func Upsert(conds *[]metav1.Condition, co metav1.Condition) {
 	for idx, el := range *conds {
 		if el.Type == co.Type {
@@ -23,6 +23,21 @@ func TestGetConditions(t *testing.T) {
 	assert.Equal(t, 1, len(all))
 }
 
+func TestSetConditionKeepsOthers(t *testing.T) {
+	un := createFakeObject()
+
+	drifted := condition.Drifted("live state differs from the release: Deployment/demo spec.replicas")
+	assert.Nil(t, SetCondition(un, drifted))
+	assert.Nil(t, SetCondition(un, condition.Available()))
+
+	all := GetConditions(un)
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, drifted.Type, all[0].Type)
+	assert.Equal(t, drifted.Reason, all[0].Reason)
+	assert.Equal(t, drifted.Message, all[0].Message)
+	assert.Equal(t, drifted.LastTransitionTime.Unix(), all[0].LastTransitionTime.Unix())
+}
+
 func TestIsAvailable(t *testing.T) {
 	un := createFakeObject()
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/gobuffalo/flect"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
@@ -67,7 +68,9 @@ func SetCondition(un *unstructured.Unstructured, co metav1.Condition) error {
 	return unstructured.SetNestedField(un.Object, res, "status", "conditions")
 }
 
-// GetConditions returns the conditions, excluding the `message` field.
+// GetConditions returns the conditions, as long as they carry type and status.
+// Message, reason and timestamps are kept, so that conditions survive being
+// set again with SetCondition.
 func GetConditions(un *unstructured.Unstructured) []metav1.Condition {
 	if un == nil {
 		return nil
@@ -79,19 +82,28 @@ func GetConditions(un *unstructured.Unstructured) []metav1.Condition {
 		if !ok {
 			return nil
 		}
-		_, ok = m["type"].(string)
+		typ, ok := m["type"].(string)
 		if !ok {
 			return nil
 		}
-		_, ok = m["status"].(string)
+		status, ok := m["status"].(string)
 		if !ok {
 			return nil
 		}
-		x = append(x, metav1.Condition{
-			Type:   m["type"].(string),
-			Status: metav1.ConditionStatus(m["status"].(string)),
-			Reason: m["reason"].(string),
-		})
+
+		co := metav1.Condition{
+			Type:   typ,
+			Status: metav1.ConditionStatus(status),
+		}
+		co.Reason, _ = m["reason"].(string)
+		co.Message, _ = m["message"].(string)
+		co.ObservedGeneration, _ = m["observedGeneration"].(int64)
+		if ts, ok := m["lastTransitionTime"].(string); ok {
+			if tm, err := time.Parse(time.RFC3339, ts); err == nil {
+				co.LastTransitionTime = metav1.NewTime(tm)
+			}
+		}
+		x = append(x, co)
 	}
 	return x
 }
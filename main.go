@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -13,12 +16,19 @@ import (
 	helmComposition "github.com/krateoplatformops/composition-dynamic-controller/internal/composition/helmComposition"
 	restComposition "github.com/krateoplatformops/composition-dynamic-controller/internal/composition/restComposition"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/crds"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/eventrecorder"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/health"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/leaderelection"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/metrics"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/support"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
 	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
 	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
@@ -34,6 +44,15 @@ var (
 )
 
 func main() {
+	if err := run(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// run starts the controller and returns once it stopped. The errors met once
+// the leader election lease may be held are returned, rather than exiting,
+// so that the lease is released.
+func run() error {
 	// Flags
 	kubeconfig := flag.String("kubeconfig", support.EnvString("KUBECONFIG", ""),
 		"absolute path to the kubeconfig file")
@@ -48,12 +67,56 @@ func main() {
 		support.EnvString("COMPOSITION_CONTROLLER_VERSION", ""), "resource api version")
 	resourceName := flag.String("resource",
 		support.EnvString("COMPOSITION_CONTROLLER_RESOURCE", ""), "resource plural name")
+	resources := flag.String("resources",
+		support.EnvString("COMPOSITION_CONTROLLER_RESOURCES", ""), "comma separated list of additional resources to watch, in the form resource.version.group")
+	crdSelector := flag.String("crd-selector",
+		support.EnvString("COMPOSITION_CONTROLLER_CRD_SELECTOR", ""), "label selector of the CRDs whose resources must be watched")
+	crdGroupSuffix := flag.String("crd-group-suffix",
+		support.EnvString("COMPOSITION_CONTROLLER_CRD_GROUP_SUFFIX", ""), "group suffix of the CRDs whose resources must be watched")
+	watchCRDs := flag.Bool("watch-crds",
+		support.EnvBool("COMPOSITION_CONTROLLER_WATCH_CRDS", false), "start and stop watching resources as matching CRDs appear and disappear")
 	namespace := flag.String("namespace",
-		support.EnvString("COMPOSITION_CONTROLLER_NAMESPACE", "default"), "namespace")
+		support.EnvString("COMPOSITION_CONTROLLER_NAMESPACE", "default"), "comma separated list of namespaces to watch")
+	allNamespaces := flag.Bool("all-namespaces",
+		support.EnvBool("COMPOSITION_CONTROLLER_ALL_NAMESPACES", false), "watch all namespaces, ignoring namespace")
+	labelSelector := flag.String("label-selector",
+		support.EnvString("COMPOSITION_CONTROLLER_LABEL_SELECTOR", ""), "label selector of the resources to watch (e.g. krateo.io/shard=a)")
+	fieldSelector := flag.String("field-selector",
+		support.EnvString("COMPOSITION_CONTROLLER_FIELD_SELECTOR", ""), "field selector of the resources to watch")
 	chart := flag.String("chart",
 		support.EnvString("COMPOSITION_CONTROLLER_CHART", ""), "chart")
 	cliType := flag.String("client",
 		support.EnvString("COMPOSITION_CLIENT_TYPE", string(client.ClientHelm)), "client type [REST|HELM]]")
+	leaderElect := flag.Bool("leader-elect",
+		support.EnvBool("COMPOSITION_CONTROLLER_LEADER_ELECT", false), "enable leader election")
+	leaderElectionNamespace := flag.String("leader-election-namespace",
+		support.EnvString("COMPOSITION_CONTROLLER_LEADER_ELECTION_NAMESPACE", ""), "namespace of the leader election lease (defaults to namespace)")
+	leaderElectionID := flag.String("leader-election-id",
+		support.EnvString("COMPOSITION_CONTROLLER_LEADER_ELECTION_ID", ""), "name of the leader election lease (defaults to the resource name)")
+	leaseDuration := flag.Duration("leader-election-lease-duration",
+		support.EnvDuration("COMPOSITION_CONTROLLER_LEADER_ELECTION_LEASE_DURATION", time.Second*15), "leader election lease duration")
+	renewDeadline := flag.Duration("leader-election-renew-deadline",
+		support.EnvDuration("COMPOSITION_CONTROLLER_LEADER_ELECTION_RENEW_DEADLINE", time.Second*10), "leader election renew deadline")
+	retryPeriod := flag.Duration("leader-election-retry-period",
+		support.EnvDuration("COMPOSITION_CONTROLLER_LEADER_ELECTION_RETRY_PERIOD", time.Second*2), "leader election retry period")
+	probeAddr := flag.String("health-probe-bind-address",
+		support.EnvString("COMPOSITION_CONTROLLER_HEALTH_PROBE_BIND_ADDRESS", ":8081"), "address the probe endpoints bind to (empty to disable)")
+	stallTimeout := flag.Duration("stall-timeout",
+		support.EnvDuration("COMPOSITION_CONTROLLER_STALL_TIMEOUT", time.Minute*10), "liveness fails if nothing is dequeued for this period while the queue is not empty")
+	maxRetries := flag.Int("max-retries",
+		support.EnvInt("COMPOSITION_CONTROLLER_MAX_RETRIES", 5), "number of retries with exponential backoff before an event is re-attempted only every dead-letter-interval")
+	minRetryBackoff := flag.Duration("min-retry-backoff",
+		support.EnvDuration("COMPOSITION_CONTROLLER_MIN_RETRY_BACKOFF", time.Second*3), "minimum backoff between retries")
+	maxRetryBackoff := flag.Duration("max-retry-backoff",
+		support.EnvDuration("COMPOSITION_CONTROLLER_MAX_RETRY_BACKOFF", time.Minute*3), "maximum backoff between retries")
+	deadLetterInterval := flag.Duration("dead-letter-interval",
+		support.EnvDuration("COMPOSITION_CONTROLLER_DEAD_LETTER_INTERVAL", time.Minute*10), "re-attempt interval of events that exhausted their retries")
+	gracePeriod := flag.Duration("shutdown-grace-period",
+		support.EnvDuration("COMPOSITION_CONTROLLER_SHUTDOWN_GRACE_PERIOD", time.Second*25), "how long in-flight reconciles are waited for on shutdown")
+	sweepInterval := flag.Duration("orphan-sweep-interval",
+		support.EnvDuration("COMPOSITION_CONTROLLER_ORPHAN_SWEEP_INTERVAL", 0), "period external resources left behind by vanished resources are looked for with (0 to disable)")
+	metricsAddr := flag.String("metrics-bind-address",
+		support.EnvString("COMPOSITION_CONTROLLER_METRICS_BIND_ADDRESS", ":8080"), "address the metrics endpoint binds to (empty to disable)")
 
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
@@ -64,7 +127,7 @@ func main() {
 	clientType, err := client.ToClientType(*cliType)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 	// Initialize the logger
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -105,6 +168,11 @@ func main() {
 		log.Fatal().Err(err).Msg("Creating event recorder.")
 	}
 
+	mapper, err := tools.NewRESTMapper(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Creating REST mapper.")
+	}
+
 	var handler controller.ExternalClient
 	switch clientType {
 	case client.ClientREST:
@@ -113,7 +181,7 @@ func main() {
 		if err != nil {
 			log.Fatal().Err(err).Msg("Creating chart url info getter.")
 		}
-		handler = restComposition.NewHandler(cfg, &log, swg)
+		handler = restComposition.NewHandler(cfg, mapper, &log, swg)
 	case client.ClientHelm:
 		var pig archive.Getter
 		if len(*chart) > 0 {
@@ -124,7 +192,7 @@ func main() {
 				log.Fatal().Err(err).Msg("Creating chart url info getter.")
 			}
 		}
-		handler = helmComposition.NewHandler(cfg, &log, pig)
+		handler = helmComposition.NewHandler(cfg, mapper, &log, pig)
 	}
 
 	log.Info().
@@ -134,12 +202,98 @@ func main() {
 		Str("group", *resourceGroup).
 		Str("version", *resourceVersion).
 		Str("resource", *resourceName).
+		Str("resources", *resources).
+		Str("crdSelector", *crdSelector).
+		Str("crdGroupSuffix", *crdGroupSuffix).
+		Bool("watchCRDs", *watchCRDs).
 		Str("clientType", clientType.String()).
+		Bool("leaderElect", *leaderElect).
 		Msgf("Starting %s.", serviceName)
 
+	ctx, cancel := signal.NotifyContext(context.Background(), []os.Signal{
+		os.Interrupt,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGKILL,
+		syscall.SIGHUP,
+		syscall.SIGQUIT,
+	}...)
+	defer cancel()
+
+	// A failing http server stops the controller as well,
+	// so that its error is returned once the lease is released.
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	gvrs, err := parseResources(*resources)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Parsing resources.")
+	}
+
+	var namespaces []string
+	if !*allNamespaces {
+		namespaces = parseNamespaces(*namespace)
+	}
+	if _, err := labels.Parse(*labelSelector); err != nil {
+		log.Fatal().Err(err).Msg("Parsing label selector.")
+	}
+	if _, err := fields.ParseSelector(*fieldSelector); err != nil {
+		log.Fatal().Err(err).Msg("Parsing field selector.")
+	}
+
+	var elected, electionDone <-chan struct{}
+	if *leaderElect {
+		leOpts := leaderelection.Options{
+			Namespace:     *leaderElectionNamespace,
+			LeaseName:     *leaderElectionID,
+			LeaseDuration: *leaseDuration,
+			RenewDeadline: *renewDeadline,
+			RetryPeriod:   *retryPeriod,
+			Logger:        &log,
+		}
+		if len(leOpts.Namespace) == 0 {
+			leOpts.Namespace = strings.TrimSpace(strings.Split(*namespace, ",")[0])
+		}
+		if len(leOpts.LeaseName) == 0 {
+			leOpts.LeaseName = serviceName
+			if len(*resourceName) > 0 {
+				leOpts.LeaseName = fmt.Sprintf("%s-%s", serviceName, *resourceName)
+			}
+		}
+
+		// The lease is held until in-flight reconciles are drained,
+		// so that no other replica takes over while they complete.
+		leCtx, leCancel := context.WithCancel(context.Background())
+		elected, electionDone, err = leaderelection.Run(leCtx, cfg, leOpts, func() {
+			log.Fatal().Msg("Leader election lost.")
+		})
+		if err != nil {
+			leCancel()
+			log.Fatal().Err(err).Msg("Starting leader election.")
+		}
+		defer func() {
+			leCancel()
+			<-electionDone
+		}()
+	}
+
+	crdFilter := crds.Filter{
+		LabelSelector: *crdSelector,
+		GroupSuffix:   *crdGroupSuffix,
+	}
+	if !*watchCRDs && (len(crdFilter.LabelSelector) > 0 || len(crdFilter.GroupSuffix) > 0) {
+		all, err := crds.List(ctx, dyn, crdFilter)
+		if err != nil {
+			log.Err(err).Msg("Listing resources by CRD selector.")
+			return err
+		}
+		gvrs = append(gvrs, all...)
+	}
+
 	sid, err := shortid.New(1, shortid.DefaultABC, 2342)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Creating shortid generator.")
+		log.Err(err).Msg("Creating shortid generator.")
+		return err
 	}
 	ctrl := controller.New(sid, controller.Options{
 		Client:         dyn,
@@ -149,25 +303,110 @@ func main() {
 			Version:  *resourceVersion,
 			Resource: *resourceName,
 		},
-		Namespace:      *namespace,
-		Recorder:       rec,
-		Logger:         &log,
-		ExternalClient: handler,
+		GVRs:                gvrs,
+		Namespaces:          namespaces,
+		LabelSelector:       *labelSelector,
+		FieldSelector:       *fieldSelector,
+		Recorder:            rec,
+		Logger:              &log,
+		ExternalClient:      handler,
+		ClientType:          clientType,
+		Elected:             elected,
+		StallTimeout:        *stallTimeout,
+		SweepInterval:       *sweepInterval,
+		ShutdownGracePeriod: *gracePeriod,
+		Retry: controller.RetryPolicy{
+			MaxRetries:         *maxRetries,
+			MinBackoff:         *minRetryBackoff,
+			MaxBackoff:         *maxRetryBackoff,
+			DeadLetterInterval: *deadLetterInterval,
+		},
 	})
 	// ctrl.SetExternalClient(handler)
 
-	ctx, cancel := signal.NotifyContext(context.Background(), []os.Signal{
-		os.Interrupt,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGKILL,
-		syscall.SIGHUP,
-		syscall.SIGQUIT,
-	}...)
-	defer cancel()
+	if *watchCRDs {
+		go crds.Watch(ctx, crds.WatchOptions{
+			Client:   dyn,
+			Filter:   crdFilter,
+			Logger:   &log,
+			OnAdd:    ctrl.AddResource,
+			OnDelete: ctrl.RemoveResource,
+		})
+	}
+
+	if len(*metricsAddr) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		srv := serve(*metricsAddr, mux, &log, stop)
+		defer srv.Shutdown(context.Background())
+	}
+
+	if len(*probeAddr) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", health.Handler(ctrl.Healthy))
+		mux.Handle("/readyz", health.Handler(ctrl.Ready))
+		srv := serve(*probeAddr, mux, &log, stop)
+		defer srv.Shutdown(context.Background())
+	}
 
 	err = ctrl.Run(ctx, *workers)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Running controller.")
+		log.Err(err).Msg("Running controller.")
+		return err
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return nil
+}
+
+// serve starts serving http on addr, calling stop with the error
+// if the server fails.
+func serve(addr string, handler http.Handler, log *zerolog.Logger, stop context.CancelCauseFunc) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().Str("addr", addr).Msg("Starting http server.")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Err(err).Str("addr", addr).Msg("Serving http.")
+			stop(fmt.Errorf("serving http on %s: %w", addr, err))
+		}
+	}()
+
+	return srv
+}
+
+// parseResources parses a comma separated list of resources in the form resource.version.group.
+func parseResources(s string) ([]schema.GroupVersionResource, error) {
+	res := []schema.GroupVersionResource{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+
+		gvr, _ := schema.ParseResourceArg(el)
+		if gvr == nil {
+			return nil, fmt.Errorf("invalid resource %q: expected resource.version.group", el)
+		}
+		res = append(res, *gvr)
+	}
+	return res, nil
+}
+
+// parseNamespaces parses a comma separated list of namespaces.
+func parseNamespaces(s string) []string {
+	res := []string{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+		res = append(res, el)
 	}
+	return res
 }